@@ -3,20 +3,38 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"smuggr.xyz/gatecam/common/config"
 	"smuggr.xyz/gatecam/core/cameras"
 	"smuggr.xyz/gatecam/core/devices"
+	"smuggr.xyz/gatecam/core/events"
+	"smuggr.xyz/gatecam/core/hls"
+	"smuggr.xyz/gatecam/core/recordings"
+	"smuggr.xyz/gatecam/core/webrtc"
 
 	"github.com/gin-gonic/gin"
 )
 
 var Config *config.APIConfig
 
+const (
+	streamWriteTimeout      = 10 * time.Second
+	eventsHeartbeatInterval = 15 * time.Second
+	hlsPlaylistTimeout      = 10 * time.Second // The first request waits for encoding to produce a segment
+	maxSDPSize              = 64 << 10
+	maxSnapshotSize         = 4096
+	defaultEventsLimit      = 100
+	maxEventsLimit          = 1000
+)
+
 func handleDeviceEndpoint(c *gin.Context, device *devices.Device) {
     endpoint := c.Param("endpoint")
     targetURL := fmt.Sprintf("http://%s:%d%s", device.GetIP(), device.GetPort(), endpoint)
@@ -44,12 +62,14 @@ func handleDeviceEndpoint(c *gin.Context, device *devices.Device) {
     client := &http.Client{}
     resp, err := client.Do(req)
     if err != nil {
+        events.Record(events.Event{Type: events.TypeDeviceError, Device: device.Name, Details: fmt.Sprintf("%s %s: %v", c.Request.Method, endpoint, err)})
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to forward request", "details": err.Error()})
         return
     }
     defer resp.Body.Close()
 
     fmt.Printf("Forwarded request to %s, response status: %d\n", targetURL, resp.StatusCode)
+    events.Record(events.Event{Type: events.TypeDeviceRequest, Device: device.Name, Details: fmt.Sprintf("%s %s: %d", c.Request.Method, endpoint, resp.StatusCode)})
 
     for key, values := range resp.Header {
         for _, value := range values {
@@ -60,20 +80,77 @@ func handleDeviceEndpoint(c *gin.Context, device *devices.Device) {
     io.Copy(c.Writer, resp.Body)
 }
 
+func parseStreamProfile(c *gin.Context) (cameras.StreamProfile, error) {
+    var profile cameras.StreamProfile
+
+    params := []struct {
+        name  string
+        value *int
+    }{
+        {"fps", &profile.FPS},
+        {"width", &profile.Width},
+        {"quality", &profile.Quality},
+    }
+    for _, param := range params {
+        value := c.Query(param.name)
+        if value == "" {
+            continue
+        }
+
+        n, err := strconv.Atoi(value)
+        if err != nil || n < 1 {
+            return profile, fmt.Errorf("%s must be a positive number", param.name)
+        }
+        *param.value = n
+    }
+
+    return profile, nil
+}
+
 func handleCameraStream(c *gin.Context, cam *cameras.Camera) {
+    requested, err := parseStreamProfile(c)
+    if err != nil {
+        Respond(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    sub, profile, err := cam.SubscribeProfile(requested)
+    if err != nil {
+        Respond(c, http.StatusNotFound, gin.H{"error": err.Error()})
+        return
+    }
+    // sub is replaced whenever the quality adapts
+    defer func() {
+        sub.Close()
+    }()
+    adapter := cam.NewQualityAdapter(profile)
+
     c.Writer.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary=frame")
 
+    events.Record(events.Event{Type: events.TypeStreamStarted, Camera: cam.Name, Details: c.ClientIP()})
+    defer func() {
+        events.Record(events.Event{Type: events.TypeStreamEnded, Camera: cam.Name, Details: c.ClientIP()})
+    }()
+
+    // A stalled client must not hold the handler forever, the broadcaster
+    // drops its frames meanwhile and disconnects it once it goes idle
+    rc := http.NewResponseController(c.Writer)
+    done := c.Request.Context().Done()
+
     for {
-        frame, err := cam.ReadFrame(config.ModeJPEGStream)
-        if err != nil {
-            fmt.Printf("error reading frame from camera %s: %v\n", cam.Name, err)
+        frame, ok := sub.Next(done)
+        if !ok {
+            fmt.Printf("client disconnected from camera %s, dropped %d frames\n", cam.Name, sub.Dropped())
             break
         }
 
+        rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+        writeStart := time.Now()
+
         fmt.Fprintf(c.Writer, "--frame\r\n")
         fmt.Fprintf(c.Writer, "Content-Type: image/jpeg\r\n")
-        fmt.Fprintf(c.Writer, "Content-Length: %d\r\n\r\n", len(frame))
-        _, err = c.Writer.Write(frame)
+        fmt.Fprintf(c.Writer, "Content-Length: %d\r\n\r\n", len(frame.Data))
+        _, err = c.Writer.Write(frame.Data)
         if err != nil {
             fmt.Printf("client disconnected from camera %s: %v\n", cam.Name, err)
             break
@@ -82,9 +159,108 @@ func handleCameraStream(c *gin.Context, cam *cameras.Camera) {
         if flusher, ok := c.Writer.(http.Flusher); ok {
             flusher.Flush()
         }
+
+        if adapter == nil {
+            continue
+        }
+
+        // Switching profiles resubscribes, the new one replays its latest frame
+        if adapted, changed := adapter.Observe(time.Since(writeStart)); changed {
+            next, nextProfile, err := cam.SubscribeProfile(adapted)
+            if err != nil {
+                fmt.Printf("stream of camera %s for %s keeps %s: %v\n", cam.Name, c.ClientIP(), profile, err)
+                adapter.Reset(profile)
+                continue
+            }
+
+            // The camera runs its maximum number of profiles and handed out
+            // the shared output, adapting further would only flip between them
+            if nextProfile != adapted {
+                next.Close()
+                fmt.Printf("stream of camera %s for %s stops adapting at %s, no profile left\n", cam.Name, c.ClientIP(), profile)
+                adapter = nil
+                continue
+            }
+
+            fmt.Printf("stream of camera %s for %s switched from %s to %s\n", cam.Name, c.ClientIP(), profile, nextProfile)
+            sub.Close()
+            sub, profile = next, nextProfile
+        }
+    }
+}
+
+func handleCameraEvents(c *gin.Context, cam *cameras.Camera) {
+    sub := cam.SubscribeEvents()
+    defer sub.Close()
+
+    c.Writer.Header().Set("Content-Type", "text/event-stream")
+    c.Writer.Header().Set("Cache-Control", "no-cache")
+    c.Writer.Header().Set("Connection", "keep-alive")
+    c.Writer.Header().Set("X-Accel-Buffering", "no")
+    c.Writer.WriteHeader(http.StatusOK)
+    c.Writer.Flush()
+
+    ctx := c.Request.Context()
+    for {
+        waitCtx, cancel := context.WithTimeout(ctx, eventsHeartbeatInterval)
+        event, ok := sub.Next(waitCtx.Done())
+        cancel()
+
+        if !ok {
+            select {
+            case <-ctx.Done():
+                return
+            case <-sub.Done():
+                return
+            default:
+            }
+
+            // Keeps proxies from closing a quiet connection
+            if _, err := fmt.Fprintf(c.Writer, ": heartbeat\n\n"); err != nil {
+                return
+            }
+            c.Writer.Flush()
+            continue
+        }
+
+        c.SSEvent(string(event.Type), event)
+        c.Writer.Flush()
     }
 }
 
+func getCamera(c *gin.Context) (*cameras.Camera, bool) {
+	camID := c.Param("id")
+
+	cam, ok := cameras.Server.GetCamera(camID)
+	if !ok {
+		Respond(c, http.StatusNotFound, gin.H{"error": fmt.Sprintf("camera not found: %s", camID)})
+		return nil, false
+	}
+
+	return cam, true
+}
+
+func authorizeCamera(c *gin.Context, cam *cameras.Camera) bool {
+	user, pass, ok := c.Request.BasicAuth()
+	if !ok || user != cam.Name || pass != cam.GetAccessKey() {
+		c.Header("WWW-Authenticate", `Basic realm="Restricted"`)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		c.Abort()
+		return false
+	}
+
+	return true
+}
+
+func getExternalCamera(c *gin.Context) (*cameras.Camera, bool) {
+	cam, ok := getCamera(c)
+	if !ok || !authorizeCamera(c, cam) {
+		return nil, false
+	}
+
+	return cam, true
+}
+
 func Respond(c *gin.Context, code int, data interface{}) {
 	accept := c.GetHeader("Accept")
 	switch {
@@ -116,11 +292,7 @@ func HandleExternalCameraStream(c *gin.Context) {
 		return
 	}
 
-	user, pass, ok := c.Request.BasicAuth()
-	if !ok || user != cam.Name || pass != cam.GetAccessKey() {
-		c.Header("WWW-Authenticate", `Basic realm="Restricted"`)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		c.Abort()
+	if !authorizeCamera(c, cam) {
 		return
 	}
 
@@ -193,6 +365,784 @@ func HandleCameraColorFrame(c *gin.Context) {
 	}
 }
 
+func parseSnapshotOptions(c *gin.Context) (cameras.JPEGOptions, error) {
+	var opts cameras.JPEGOptions
+
+	ints := []struct {
+		name  string
+		value *int
+		max   int
+	}{
+		{"w", &opts.Width, maxSnapshotSize},
+		{"h", &opts.Height, maxSnapshotSize},
+		{"q", &opts.Quality, 100},
+	}
+	for _, param := range ints {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > param.max {
+			return opts, fmt.Errorf("%s must be between 1 and %d", param.name, param.max)
+		}
+		*param.value = n
+	}
+
+	if value := c.Query("overlay"); value != "" {
+		overlay, err := strconv.ParseBool(value)
+		if err != nil {
+			return opts, fmt.Errorf("invalid overlay: %s", value)
+		}
+		opts.Overlay = &overlay
+	}
+
+	return opts, nil
+}
+
+func handleCameraSnapshot(c *gin.Context, cam *cameras.Camera) {
+	opts, err := parseSnapshotOptions(c)
+	if err != nil {
+		Respond(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	frame := cam.LatestFrame()
+	if frame == nil {
+		Respond(c, http.StatusServiceUnavailable, gin.H{"error": fmt.Sprintf("camera %s has no frame yet", cam.Name)})
+		return
+	}
+	defer frame.Release()
+
+	// The tag is known before encoding, so unchanged frames are not encoded again
+	overlay := "default"
+	if opts.Overlay != nil {
+		overlay = strconv.FormatBool(*opts.Overlay)
+	}
+	etag := fmt.Sprintf(`"%x-%d-%dx%d-q%d-%s"`, cam.Epoch(), frame.Seq, opts.Width, opts.Height, opts.Quality, overlay)
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "no-cache")
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	encoded, err := cam.EncodeJPEG(frame, opts)
+	if err != nil {
+		fmt.Printf("error encoding snapshot of camera %s: %v\n", cam.Name, err)
+		Respond(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Frames change far more often than the second resolution of
+	// Last-Modified, so conditional requests rely on the ETag alone
+	c.Header("Content-Type", "image/jpeg")
+	http.ServeContent(c.Writer, c.Request, "snapshot.jpg", time.Time{}, bytes.NewReader(encoded.Data))
+}
+
+func HandleCameraSnapshot(c *gin.Context) {
+	cam, ok := getCamera(c)
+	if !ok {
+		return
+	}
+
+	handleCameraSnapshot(c, cam)
+}
+
+func HandleExternalCameraSnapshot(c *gin.Context) {
+	cam, ok := getExternalCamera(c)
+	if !ok {
+		return
+	}
+
+	handleCameraSnapshot(c, cam)
+}
+
+func getHLSStream(c *gin.Context, cam *cameras.Camera) (*hls.Stream, bool) {
+	stream, ok := hls.GetStream(cam)
+	if !ok {
+		Respond(c, http.StatusNotFound, gin.H{"error": fmt.Sprintf("HLS is disabled for camera %s", cam.Name)})
+	}
+	return stream, ok
+}
+
+func handleCameraHLSPlaylist(c *gin.Context, cam *cameras.Camera) {
+	stream, ok := getHLSStream(c, cam)
+	if !ok {
+		return
+	}
+
+	playlist, err := stream.Playlist(hlsPlaylistTimeout)
+	if err != nil {
+		Respond(c, http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Data(http.StatusOK, "application/vnd.apple.mpegurl", playlist)
+}
+
+func handleCameraHLSSegment(c *gin.Context, cam *cameras.Camera) {
+	stream, ok := getHLSStream(c, cam)
+	if !ok {
+		return
+	}
+
+	path, ok := stream.SegmentPath(c.Param("segment"))
+	if !ok {
+		Respond(c, http.StatusNotFound, gin.H{"error": fmt.Sprintf("segment not found: %s", c.Param("segment"))})
+		return
+	}
+
+	c.Header("Content-Type", "video/mp2t")
+	c.File(path)
+}
+
+func HandleCameraHLSPlaylist(c *gin.Context) {
+	cam, ok := getCamera(c)
+	if !ok {
+		return
+	}
+
+	handleCameraHLSPlaylist(c, cam)
+}
+
+func HandleExternalCameraHLSPlaylist(c *gin.Context) {
+	cam, ok := getExternalCamera(c)
+	if !ok {
+		return
+	}
+
+	handleCameraHLSPlaylist(c, cam)
+}
+
+func HandleCameraHLSSegment(c *gin.Context) {
+	cam, ok := getCamera(c)
+	if !ok {
+		return
+	}
+
+	handleCameraHLSSegment(c, cam)
+}
+
+func HandleExternalCameraHLSSegment(c *gin.Context) {
+	cam, ok := getExternalCamera(c)
+	if !ok {
+		return
+	}
+
+	handleCameraHLSSegment(c, cam)
+}
+
+func getWebRTCStream(c *gin.Context, cam *cameras.Camera) (*webrtc.Stream, bool) {
+	stream, ok := webrtc.GetStream(cam)
+	if !ok {
+		Respond(c, http.StatusNotFound, gin.H{"error": fmt.Sprintf("WebRTC is disabled for camera %s", cam.Name)})
+	}
+	return stream, ok
+}
+
+func handleCameraWHEP(c *gin.Context, cam *cameras.Camera) {
+	stream, ok := getWebRTCStream(c, cam)
+	if !ok {
+		return
+	}
+
+	if !strings.HasPrefix(c.ContentType(), "application/sdp") {
+		Respond(c, http.StatusUnsupportedMediaType, gin.H{"error": "offer must be application/sdp"})
+		return
+	}
+
+	offer, err := io.ReadAll(io.LimitReader(c.Request.Body, maxSDPSize))
+	if err != nil || len(offer) == 0 {
+		Respond(c, http.StatusBadRequest, gin.H{"error": "missing offer"})
+		return
+	}
+
+	sess, answer, err := stream.Answer(string(offer))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+sess.ID)
+	c.Data(http.StatusCreated, "application/sdp", []byte(answer))
+}
+
+func handleCameraWHEPSession(c *gin.Context, cam *cameras.Camera) {
+	stream, ok := getWebRTCStream(c, cam)
+	if !ok {
+		return
+	}
+
+	sess, ok := stream.Session(c.Param("session"))
+	if !ok {
+		Respond(c, http.StatusNotFound, gin.H{"error": fmt.Sprintf("session not found: %s", c.Param("session"))})
+		return
+	}
+
+	sess.Close()
+	c.Status(http.StatusOK)
+}
+
+func HandleCameraWHEP(c *gin.Context) {
+	cam, ok := getCamera(c)
+	if !ok {
+		return
+	}
+
+	handleCameraWHEP(c, cam)
+}
+
+func HandleExternalCameraWHEP(c *gin.Context) {
+	cam, ok := getExternalCamera(c)
+	if !ok {
+		return
+	}
+
+	handleCameraWHEP(c, cam)
+}
+
+func HandleCameraWHEPSession(c *gin.Context) {
+	cam, ok := getCamera(c)
+	if !ok {
+		return
+	}
+
+	handleCameraWHEPSession(c, cam)
+}
+
+func HandleExternalCameraWHEPSession(c *gin.Context) {
+	cam, ok := getExternalCamera(c)
+	if !ok {
+		return
+	}
+
+	handleCameraWHEPSession(c, cam)
+}
+
+func HandleCameraStatus(c *gin.Context) {
+	camID := c.Param("id")
+
+	cam, ok := cameras.Server.GetCamera(camID)
+	if !ok {
+		Respond(c, http.StatusNotFound, gin.H{"error": fmt.Sprintf("camera not found: %s", camID)})
+		return
+	}
+
+	Respond(c, http.StatusOK, cam.Stats())
+}
+
+func HandleCameraDetections(c *gin.Context) {
+	cam, ok := getCamera(c)
+	if !ok {
+		return
+	}
+
+	Respond(c, http.StatusOK, cam.Detections())
+}
+
+func HandleExternalCameraDetections(c *gin.Context) {
+	cam, ok := getExternalCamera(c)
+	if !ok {
+		return
+	}
+
+	Respond(c, http.StatusOK, cam.Detections())
+}
+
+func respondCameraMotion(c *gin.Context, cam *cameras.Camera) {
+	motion, ok := cam.Motion()
+	if !ok {
+		Respond(c, http.StatusNotFound, gin.H{"error": fmt.Sprintf("motion detection is disabled for camera %s", cam.Name)})
+		return
+	}
+
+	Respond(c, http.StatusOK, motion)
+}
+
+func HandleCameraMotion(c *gin.Context) {
+	cam, ok := getCamera(c)
+	if !ok {
+		return
+	}
+
+	respondCameraMotion(c, cam)
+}
+
+func HandleExternalCameraMotion(c *gin.Context) {
+	cam, ok := getExternalCamera(c)
+	if !ok {
+		return
+	}
+
+	respondCameraMotion(c, cam)
+}
+
+func HandleCameraEvents(c *gin.Context) {
+	cam, ok := getCamera(c)
+	if !ok {
+		return
+	}
+
+	handleCameraEvents(c, cam)
+}
+
+func HandleExternalCameraEvents(c *gin.Context) {
+	cam, ok := getExternalCamera(c)
+	if !ok {
+		return
+	}
+
+	handleCameraEvents(c, cam)
+}
+
+type ZonesRequest struct {
+	Zones []config.ZoneConfig `json:"zones"`
+	Lines []config.LineConfig `json:"lines"`
+}
+
+func HandleGetCameraZones(c *gin.Context) {
+	cam, ok := getCamera(c)
+	if !ok {
+		return
+	}
+
+	zones, lines := cam.Zones()
+	Respond(c, http.StatusOK, ZonesRequest{Zones: zones, Lines: lines})
+}
+
+func HandleSetCameraZones(c *gin.Context) {
+	cam, ok := getCamera(c)
+	if !ok {
+		return
+	}
+
+	var req ZonesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := cam.SetZones(req.Zones, req.Lines); err != nil {
+		Respond(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	zones, lines := cam.Zones()
+	Respond(c, http.StatusOK, ZonesRequest{Zones: zones, Lines: lines})
+}
+
+type SeekRequest struct {
+	Position float64 `json:"position" binding:"min=0"` // Seconds from the start of the file
+}
+
+func HandleCameraSeek(c *gin.Context) {
+	camID := c.Param("id")
+
+	cam, ok := cameras.Server.GetCamera(camID)
+	if !ok {
+		Respond(c, http.StatusNotFound, gin.H{"error": fmt.Sprintf("camera not found: %s", camID)})
+		return
+	}
+
+	var req SeekRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := cam.Seek(time.Duration(req.Position * float64(time.Second))); err != nil {
+		Respond(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	position, duration, _ := cam.PlaybackPosition()
+	Respond(c, http.StatusOK, gin.H{"position": position.Seconds(), "duration": duration.Seconds()})
+}
+
+// Accepts RFC 3339 timestamps or unix seconds.
+func parseQueryTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func HandleGetEvents(c *gin.Context) {
+	filter := events.Filter{
+		Camera: c.Query("camera"),
+		Label:  c.Query("label"),
+		Type:   c.Query("type"),
+		Limit:  defaultEventsLimit,
+	}
+
+	// Cameras can be referred to by order like in the camera routes
+	if cam, ok := cameras.Server.GetCamera(filter.Camera); ok {
+		filter.Camera = cam.Name
+	}
+
+	var err error
+	if filter.Since, err = parseQueryTime(c.Query("since")); err != nil {
+		Respond(c, http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid since: %v", err)})
+		return
+	}
+	if filter.Until, err = parseQueryTime(c.Query("until")); err != nil {
+		Respond(c, http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid until: %v", err)})
+		return
+	}
+
+	if value := c.Query("limit"); value != "" {
+		if filter.Limit, err = strconv.Atoi(value); err != nil || filter.Limit <= 0 || filter.Limit > maxEventsLimit {
+			Respond(c, http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxEventsLimit)})
+			return
+		}
+	}
+	if value := c.Query("offset"); value != "" {
+		if filter.Offset, err = strconv.Atoi(value); err != nil || filter.Offset < 0 {
+			Respond(c, http.StatusBadRequest, gin.H{"error": "offset must not be negative"})
+			return
+		}
+	}
+
+	history, total, err := events.Query(filter)
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	Respond(c, http.StatusOK, gin.H{"events": history, "total": total, "limit": filter.Limit, "offset": filter.Offset})
+}
+
+func handleEventMedia(c *gin.Context, thumbnail bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		Respond(c, http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid event id: %s", c.Param("id"))})
+		return
+	}
+
+	event, ok, err := events.Get(id)
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !ok {
+		Respond(c, http.StatusNotFound, gin.H{"error": fmt.Sprintf("event not found: %d", id)})
+		return
+	}
+
+	name := event.Snapshot
+	if thumbnail {
+		name = event.Thumbnail
+	}
+	if name == "" {
+		Respond(c, http.StatusNotFound, gin.H{"error": fmt.Sprintf("event %d has no snapshot", id)})
+		return
+	}
+
+	path, err := events.MediaPath(name)
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		Respond(c, http.StatusNotFound, gin.H{"error": fmt.Sprintf("snapshot of event %d was removed", id)})
+		return
+	}
+
+	c.File(path)
+}
+
+func HandleGetEventSnapshot(c *gin.Context) {
+	handleEventMedia(c, false)
+}
+
+func HandleGetEventThumbnail(c *gin.Context) {
+	handleEventMedia(c, true)
+}
+
+func handleCameraRecordings(c *gin.Context, cam *cameras.Camera) {
+	from, err := parseQueryTime(c.Query("from"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid from: %v", err)})
+		return
+	}
+	to, err := parseQueryTime(c.Query("to"))
+	if err != nil {
+		Respond(c, http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid to: %v", err)})
+		return
+	}
+
+	segments, err := recordings.Timeline(cam.Name, from, to)
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	Respond(c, http.StatusOK, gin.H{"camera": cam.Name, "recordings": segments})
+}
+
+// Served with http.ServeContent so players can seek with Range requests.
+func handleCameraRecording(c *gin.Context, cam *cameras.Camera) {
+	id := c.Param("recording")
+	seg, ok, err := recordings.Find(cam.Name, id)
+	if err != nil {
+		Respond(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !ok {
+		Respond(c, http.StatusNotFound, gin.H{"error": fmt.Sprintf("recording not found: %s", id)})
+		return
+	}
+
+	file, err := recordings.Open(seg)
+	if err != nil {
+		Respond(c, http.StatusNotFound, gin.H{"error": fmt.Sprintf("recording %s is not available: %v", id, err)})
+		return
+	}
+	defer file.Close()
+
+	c.Header("Content-Type", recordings.ContentType(seg))
+	http.ServeContent(c.Writer, c.Request, seg.Path, seg.End, file)
+}
+
+func handleCameraRecordingFrame(c *gin.Context, cam *cameras.Camera) {
+	at, err := parseQueryTime(c.Query("at"))
+	if err != nil || at.IsZero() {
+		Respond(c, http.StatusBadRequest, gin.H{"error": "at must be an RFC 3339 timestamp or unix seconds"})
+		return
+	}
+
+	data, err := recordings.FrameAt(cam.Name, at)
+	if err != nil {
+		Respond(c, http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Data(http.StatusOK, "image/jpeg", data)
+}
+
+type ExportRequest struct {
+	From    time.Time `json:"from" binding:"required"`
+	To      time.Time `json:"to" binding:"required"`
+	Overlay bool      `json:"overlay"` // Burns in the camera name and timestamp
+}
+
+// URLs are relative to the export collection of the camera so they work on
+// both routers and behind the reverse proxy.
+func respondExport(c *gin.Context, code int, exportsPath string, job recordings.ExportJob) {
+	statusURL := fmt.Sprintf("%s/%s", strings.TrimSuffix(exportsPath, "/"), job.ID)
+	Respond(c, code, gin.H{"export": job, "status_url": statusURL, "download_url": statusURL + "/download"})
+}
+
+func handleCameraExport(c *gin.Context, cam *cameras.Camera) {
+	var req ExportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	job, err := recordings.StartExport(cam.Name, req.From, req.To, req.Overlay)
+	if err != nil {
+		Respond(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	respondExport(c, http.StatusAccepted, c.Request.URL.Path, job)
+}
+
+type TimelapseRequest struct {
+	From      time.Time `json:"from" binding:"required"`
+	To        time.Time `json:"to" binding:"required"`
+	Interval  float64   `json:"interval" binding:"gt=0"` // Seconds between sampled frames
+	FrameRate int       `json:"frame_rate" binding:"min=0"`
+	Overlay   bool      `json:"overlay"`
+}
+
+// Runs as an export job, so it is polled and downloaded like one.
+func handleCameraTimelapse(c *gin.Context, cam *cameras.Camera) {
+	var req TimelapseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		Respond(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	interval := time.Duration(req.Interval * float64(time.Second))
+	job, err := recordings.StartTimelapse(cam.Name, req.From, req.To, interval, req.FrameRate, req.Overlay)
+	if err != nil {
+		Respond(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	exportsPath := strings.TrimSuffix(c.Request.URL.Path, "/timelapse") + "/export"
+	respondExport(c, http.StatusAccepted, exportsPath, job)
+}
+
+func handleCameraExportStatus(c *gin.Context, cam *cameras.Camera) {
+	id := c.Param("export")
+	job, ok := recordings.GetExport(cam.Name, id)
+	if !ok {
+		Respond(c, http.StatusNotFound, gin.H{"error": fmt.Sprintf("export not found or expired: %s", id)})
+		return
+	}
+
+	respondExport(c, http.StatusOK, strings.TrimSuffix(c.Request.URL.Path, "/"+id), job)
+}
+
+func handleCameraExportDownload(c *gin.Context, cam *cameras.Camera) {
+	id := c.Param("export")
+	file, job, err := recordings.OpenExport(cam.Name, id)
+	if err != nil {
+		code := http.StatusNotFound
+		switch {
+		case job.ID == "":
+		case job.Status != recordings.ExportDone:
+			code = http.StatusConflict
+		case !os.IsNotExist(err):
+			fmt.Printf("error opening export %s of camera %s: %v\n", id, cam.Name, err)
+			code = http.StatusInternalServerError
+		}
+		Respond(c, code, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	name := fmt.Sprintf("%s_%s_%s.avi", cam.Name, job.Kind, job.From.Format("20060102_150405"))
+	c.Header("Content-Type", "video/x-msvideo")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	http.ServeContent(c.Writer, c.Request, name, job.CreatedAt, file)
+}
+
+func HandleCameraExport(c *gin.Context) {
+	cam, ok := getCamera(c)
+	if !ok {
+		return
+	}
+
+	handleCameraExport(c, cam)
+}
+
+func HandleExternalCameraExport(c *gin.Context) {
+	cam, ok := getExternalCamera(c)
+	if !ok {
+		return
+	}
+
+	handleCameraExport(c, cam)
+}
+
+func HandleCameraTimelapse(c *gin.Context) {
+	cam, ok := getCamera(c)
+	if !ok {
+		return
+	}
+
+	handleCameraTimelapse(c, cam)
+}
+
+func HandleExternalCameraTimelapse(c *gin.Context) {
+	cam, ok := getExternalCamera(c)
+	if !ok {
+		return
+	}
+
+	handleCameraTimelapse(c, cam)
+}
+
+func HandleCameraExportStatus(c *gin.Context) {
+	cam, ok := getCamera(c)
+	if !ok {
+		return
+	}
+
+	handleCameraExportStatus(c, cam)
+}
+
+func HandleExternalCameraExportStatus(c *gin.Context) {
+	cam, ok := getExternalCamera(c)
+	if !ok {
+		return
+	}
+
+	handleCameraExportStatus(c, cam)
+}
+
+func HandleCameraExportDownload(c *gin.Context) {
+	cam, ok := getCamera(c)
+	if !ok {
+		return
+	}
+
+	handleCameraExportDownload(c, cam)
+}
+
+func HandleExternalCameraExportDownload(c *gin.Context) {
+	cam, ok := getExternalCamera(c)
+	if !ok {
+		return
+	}
+
+	handleCameraExportDownload(c, cam)
+}
+
+func HandleCameraRecordings(c *gin.Context) {
+	cam, ok := getCamera(c)
+	if !ok {
+		return
+	}
+
+	handleCameraRecordings(c, cam)
+}
+
+func HandleExternalCameraRecordings(c *gin.Context) {
+	cam, ok := getExternalCamera(c)
+	if !ok {
+		return
+	}
+
+	handleCameraRecordings(c, cam)
+}
+
+func HandleCameraRecording(c *gin.Context) {
+	cam, ok := getCamera(c)
+	if !ok {
+		return
+	}
+
+	handleCameraRecording(c, cam)
+}
+
+func HandleExternalCameraRecording(c *gin.Context) {
+	cam, ok := getExternalCamera(c)
+	if !ok {
+		return
+	}
+
+	handleCameraRecording(c, cam)
+}
+
+func HandleCameraRecordingFrame(c *gin.Context) {
+	cam, ok := getCamera(c)
+	if !ok {
+		return
+	}
+
+	handleCameraRecordingFrame(c, cam)
+}
+
+func HandleExternalCameraRecordingFrame(c *gin.Context) {
+	cam, ok := getExternalCamera(c)
+	if !ok {
+		return
+	}
+
+	handleCameraRecordingFrame(c, cam)
+}
+
 func HandleExternalDeviceEndpoint(c *gin.Context) {
     devID := c.Param("id")
 	device, ok := devices.Server.GetDevice(devID)
@@ -0,0 +1,301 @@
+// handlers/websocket.go
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"smuggr.xyz/gatecam/common/config"
+	"smuggr.xyz/gatecam/core/cameras"
+	"smuggr.xyz/gatecam/core/events"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsControlLimit = 4096
+	wsPongTimeout  = 60 * time.Second
+	wsPingInterval = 25 * time.Second
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 64 << 10,
+}
+
+type wsControl struct {
+	Type    string `json:"type"` // quality, fps, pause, resume or snapshot
+	Quality int    `json:"quality,omitempty"`
+	FPS     int    `json:"fps,omitempty"`
+}
+
+// Sent as a text message before the binary JPEG it describes.
+type wsFrameHeader struct {
+	Type       string           `json:"type"`
+	Seq        uint64           `json:"seq"`
+	Timestamp  time.Time        `json:"timestamp"`
+	Width      int              `json:"width"`
+	Height     int              `json:"height"`
+	Size       int              `json:"size"`
+	Snapshot   bool             `json:"snapshot,omitempty"`
+	Detections []cameras.Entity `json:"detections"`
+}
+
+type wsStatus struct {
+	Type    string `json:"type"`
+	Quality int    `json:"quality"`
+	FPS     int    `json:"fps"`
+	Paused  bool   `json:"paused"`
+	Error   string `json:"error,omitempty"`
+}
+
+type wsClient struct {
+	conn     *websocket.Conn
+	cam      *cameras.Camera
+	quality  int // 0 keeps the shared jpeg_stream output
+	fps      int // 0 sends every frame
+	paused   bool
+	lastSent time.Time
+}
+
+func (ws *wsClient) write(messageType int, data []byte) error {
+	ws.conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	return ws.conn.WriteMessage(messageType, data)
+}
+
+func (ws *wsClient) writeJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ws.write(websocket.TextMessage, data)
+}
+
+func (ws *wsClient) sendFrame(frame *cameras.EncodedFrame, snapshot bool) error {
+	detections := frame.Detections
+	if detections == nil {
+		detections = []cameras.Entity{}
+	}
+
+	err := ws.writeJSON(wsFrameHeader{
+		Type:       "frame",
+		Seq:        frame.Seq,
+		Timestamp:  frame.Timestamp,
+		Width:      frame.Width,
+		Height:     frame.Height,
+		Size:       len(frame.Data),
+		Snapshot:   snapshot,
+		Detections: detections,
+	})
+	if err != nil {
+		return err
+	}
+
+	return ws.write(websocket.BinaryMessage, frame.Data)
+}
+
+func (ws *wsClient) sendStatus(errMsg string) error {
+	return ws.writeJSON(wsStatus{
+		Type:    "status",
+		Quality: ws.quality,
+		FPS:     ws.fps,
+		Paused:  ws.paused,
+		Error:   errMsg,
+	})
+}
+
+// Re-encodes the newest captured frame when the client asked for its own
+// quality, otherwise the shared output is sent as-is.
+func (ws *wsClient) encode(shared *cameras.EncodedFrame) (*cameras.EncodedFrame, error) {
+	if ws.quality == 0 {
+		return shared, nil
+	}
+
+	frame := ws.cam.LatestFrame()
+	if frame == nil {
+		return shared, nil
+	}
+	defer frame.Release()
+
+	return ws.cam.EncodeJPEG(frame, cameras.JPEGOptions{Quality: ws.quality})
+}
+
+func (ws *wsClient) handleFrame(frame *cameras.EncodedFrame) error {
+	if ws.paused {
+		return nil
+	}
+
+	now := time.Now()
+	if ws.fps > 0 && now.Sub(ws.lastSent) < time.Second/time.Duration(ws.fps) {
+		return nil
+	}
+
+	encoded, err := ws.encode(frame)
+	if err != nil {
+		return ws.sendStatus(err.Error())
+	}
+
+	ws.lastSent = now
+	return ws.sendFrame(encoded, false)
+}
+
+func (ws *wsClient) snapshot() error {
+	frame := ws.cam.LatestFrame()
+	if frame == nil {
+		return ws.sendStatus("no frame available")
+	}
+	defer frame.Release()
+
+	encoded, err := ws.cam.EncodeJPEG(frame, cameras.JPEGOptions{Quality: ws.quality})
+	if err != nil {
+		return ws.sendStatus(err.Error())
+	}
+
+	return ws.sendFrame(encoded, true)
+}
+
+func (ws *wsClient) handleControl(control wsControl) error {
+	switch control.Type {
+	case "quality":
+		if control.Quality < 0 || control.Quality > 100 {
+			return ws.sendStatus("quality must be between 1 and 100, 0 restores the default")
+		}
+		ws.quality = control.Quality
+	case "fps":
+		if control.FPS < 0 {
+			return ws.sendStatus("fps must not be negative, 0 sends every frame")
+		}
+		ws.fps = control.FPS
+	case "pause":
+		ws.paused = true
+	case "resume":
+		ws.paused = false
+	case "snapshot":
+		return ws.snapshot()
+	default:
+		return ws.sendStatus(fmt.Sprintf("unknown control: %s", control.Type))
+	}
+
+	return ws.sendStatus("")
+}
+
+// Control messages are read on their own goroutine since gorilla only
+// allows one concurrent reader, all writes stay on the handler goroutine.
+func (ws *wsClient) readControls(controls chan<- wsControl, done chan<- struct{}, stop <-chan struct{}) {
+	defer close(done)
+
+	ws.conn.SetReadLimit(wsControlLimit)
+	ws.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	ws.conn.SetPongHandler(func(string) error {
+		return ws.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+
+	for {
+		_, data, err := ws.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		ws.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+
+		var control wsControl
+		if err := json.Unmarshal(data, &control); err != nil {
+			control = wsControl{Type: "invalid"}
+		}
+		select {
+		case controls <- control:
+		case <-stop:
+			return
+		}
+	}
+}
+
+func handleCameraWebSocket(c *gin.Context, cam *cameras.Camera) {
+	sub, err := cam.Subscribe(config.ModeJPEGStream)
+	if err != nil {
+		Respond(c, http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	defer sub.Close()
+
+	conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader already responded
+		return
+	}
+	defer conn.Close()
+
+	events.Record(events.Event{Type: events.TypeStreamStarted, Camera: cam.Name, Details: c.ClientIP()})
+	defer func() {
+		events.Record(events.Event{Type: events.TypeStreamEnded, Camera: cam.Name, Details: c.ClientIP()})
+	}()
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	ws := &wsClient{conn: conn, cam: cam}
+	controls := make(chan wsControl)
+	readerDone := make(chan struct{})
+	go ws.readControls(controls, readerDone, stop)
+
+	frames := make(chan *cameras.EncodedFrame)
+	go func() {
+		for {
+			frame, ok := sub.Next(stop)
+			if !ok {
+				close(frames)
+				return
+			}
+			select {
+			case frames <- frame:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case frame, ok := <-frames:
+			if !ok {
+				fmt.Printf("client disconnected from camera %s, dropped %d frames\n", cam.Name, sub.Dropped())
+				return
+			}
+			err = ws.handleFrame(frame)
+		case control := <-controls:
+			err = ws.handleControl(control)
+		case <-ping.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout))
+		case <-readerDone:
+			return
+		}
+
+		if err != nil {
+			fmt.Printf("client disconnected from camera %s: %v\n", cam.Name, err)
+			return
+		}
+	}
+}
+
+func HandleCameraWebSocket(c *gin.Context) {
+	cam, ok := getCamera(c)
+	if !ok {
+		return
+	}
+
+	handleCameraWebSocket(c, cam)
+}
+
+func HandleExternalCameraWebSocket(c *gin.Context) {
+	cam, ok := getExternalCamera(c)
+	if !ok {
+		return
+	}
+
+	handleCameraWebSocket(c, cam)
+}
@@ -43,14 +43,59 @@ func SetupCameraRoutes(router *gin.Engine, externalRouter *gin.Engine, rootGroup
 	cameraGroup := camerasGroup.Group("/:id")
 	{
 		cameraGroup.GET("/stream", handlers.HandleCameraStream)
+		cameraGroup.GET("/ws", handlers.HandleCameraWebSocket)
+		cameraGroup.GET("/snapshot.jpg", handlers.HandleCameraSnapshot)
+		cameraGroup.GET("/hls/index.m3u8", handlers.HandleCameraHLSPlaylist)
+		cameraGroup.GET("/hls/:segment", handlers.HandleCameraHLSSegment)
+		cameraGroup.POST("/whep", handlers.HandleCameraWHEP)
+		cameraGroup.DELETE("/whep/:session", handlers.HandleCameraWHEPSession)
+		cameraGroup.GET("/status", handlers.HandleCameraStatus)
+		cameraGroup.GET("/detections", handlers.HandleCameraDetections)
+		cameraGroup.GET("/motion", handlers.HandleCameraMotion)
+		cameraGroup.GET("/events", handlers.HandleCameraEvents)
+		cameraGroup.GET("/zones", handlers.HandleGetCameraZones)
+		cameraGroup.PUT("/zones", handlers.HandleSetCameraZones)
 		cameraGroup.GET("/raw_grayscale_frame", handlers.HandleCameraGrayscaleFrame)
 		cameraGroup.GET("/raw_color_frame", handlers.HandleCameraColorFrame)
+		cameraGroup.POST("/seek", handlers.HandleCameraSeek)
+		cameraGroup.GET("/recordings", handlers.HandleCameraRecordings)
+		cameraGroup.GET("/recordings/:recording", handlers.HandleCameraRecording)
+		cameraGroup.GET("/recording_frame", handlers.HandleCameraRecordingFrame)
+		cameraGroup.POST("/export", handlers.HandleCameraExport)
+		cameraGroup.GET("/export/:export", handlers.HandleCameraExportStatus)
+		cameraGroup.GET("/export/:export/download", handlers.HandleCameraExportDownload)
+		cameraGroup.POST("/timelapse", handlers.HandleCameraTimelapse)
 	}
 
 	externalCamerasGroup := externalRootGroup.Group("/camera")
 	externalCameraGroup := externalCamerasGroup.Group("/:id")
 	{
 		externalCameraGroup.GET("/stream", handlers.HandleExternalCameraStream)
+		externalCameraGroup.GET("/ws", handlers.HandleExternalCameraWebSocket)
+		externalCameraGroup.GET("/snapshot.jpg", handlers.HandleExternalCameraSnapshot)
+		externalCameraGroup.GET("/hls/index.m3u8", handlers.HandleExternalCameraHLSPlaylist)
+		externalCameraGroup.GET("/hls/:segment", handlers.HandleExternalCameraHLSSegment)
+		externalCameraGroup.POST("/whep", handlers.HandleExternalCameraWHEP)
+		externalCameraGroup.DELETE("/whep/:session", handlers.HandleExternalCameraWHEPSession)
+		externalCameraGroup.GET("/detections", handlers.HandleExternalCameraDetections)
+		externalCameraGroup.GET("/motion", handlers.HandleExternalCameraMotion)
+		externalCameraGroup.GET("/events", handlers.HandleExternalCameraEvents)
+		externalCameraGroup.GET("/recordings", handlers.HandleExternalCameraRecordings)
+		externalCameraGroup.GET("/recordings/:recording", handlers.HandleExternalCameraRecording)
+		externalCameraGroup.GET("/recording_frame", handlers.HandleExternalCameraRecordingFrame)
+		externalCameraGroup.POST("/export", handlers.HandleExternalCameraExport)
+		externalCameraGroup.GET("/export/:export", handlers.HandleExternalCameraExportStatus)
+		externalCameraGroup.GET("/export/:export/download", handlers.HandleExternalCameraExportDownload)
+		externalCameraGroup.POST("/timelapse", handlers.HandleExternalCameraTimelapse)
+	}
+}
+
+func SetupEventRoutes(router *gin.Engine, externalRouter *gin.Engine, rootGroup *gin.RouterGroup, externalRootGroup *gin.RouterGroup) {
+	eventsGroup := rootGroup.Group("/events")
+	{
+		eventsGroup.GET("", handlers.HandleGetEvents)
+		eventsGroup.GET("/:id/snapshot", handlers.HandleGetEventSnapshot)
+		eventsGroup.GET("/:id/thumbnail", handlers.HandleGetEventThumbnail)
 	}
 }
 
@@ -78,6 +123,7 @@ func Initialize(defaultRouter *gin.Engine, externalRouter *gin.Engine) {
 
 	SetupCameraRoutes(defaultRouter, externalRouter, rootGroup, externalRootGroup)
 	SetupDeviceRoutes(defaultRouter, externalRouter, rootGroup, externalRootGroup)
+	SetupEventRoutes(defaultRouter, externalRouter, rootGroup, externalRootGroup)
 
 	handlers.Initialize()
 }
@@ -11,6 +11,11 @@ import (
 	"smuggr.xyz/gatecam/common/config"
 	"smuggr.xyz/gatecam/core/cameras"
 	"smuggr.xyz/gatecam/core/devices"
+	"smuggr.xyz/gatecam/core/events"
+	"smuggr.xyz/gatecam/core/hls"
+	"smuggr.xyz/gatecam/core/recordings"
+	"smuggr.xyz/gatecam/core/rtsp"
+	"smuggr.xyz/gatecam/core/webrtc"
 )
 
 func WaitForTermination() {
@@ -25,7 +30,12 @@ func WaitForTermination() {
 func Cleanup() {
 	fmt.Println("cleaning up...")
 
+	rtsp.Close()
+	webrtc.Close()
+	hls.Close()
+	recordings.Close()
 	cameras.Server.CloseAll()
+	events.Close()
 }
 
 func main() {
@@ -39,6 +49,24 @@ func main() {
 
 	devices.Initialize()
 
+	if err := events.Initialize(); err != nil {
+		panic(err)
+	}
+
+	if err := recordings.Initialize(); err != nil {
+		panic(err)
+	}
+
+	hls.Initialize()
+
+	if err := webrtc.Initialize(); err != nil {
+		panic(err)
+	}
+
+	if err := rtsp.Initialize(); err != nil {
+		panic(err)
+	}
+
 	errCh := v1.Initialize()
 
 	defer Cleanup()
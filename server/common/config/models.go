@@ -1,9 +1,13 @@
 // config/models.go
 package config
 
+import "time"
+
 type APIConfig struct {
 	Port         int16 `mapstructure:"port"`
 	ExternalPort int16 `mapstructure:"external_port"`
+	RTSPPort     int16 `mapstructure:"rtsp_port"`     // Built-in RTSP server publishing every jpeg_stream mode, disabled when 0
+	RTSPUDPPort  int16 `mapstructure:"rtsp_udp_port"` // Even port for RTP over UDP, RTCP uses the next one. TCP only when 0
 }
 
 type CameraMode string
@@ -18,6 +22,46 @@ func (cm CameraMode) String() string {
 	return string(cm)
 }
 
+type SourceType string
+
+const (
+	SourceDevice      SourceType = "device"
+	SourceDisplay     SourceType = "display"
+	SourceTestPattern SourceType = "test_pattern"
+	SourceFile        SourceType = "file"
+	SourceRTSP        SourceType = "rtsp"
+	SourceMJPEG       SourceType = "mjpeg"
+)
+
+func (st SourceType) String() string {
+	return string(st)
+}
+
+type PlaybackMode string
+
+const (
+	PlaybackLoop PlaybackMode = "loop"
+	PlaybackOnce PlaybackMode = "once"
+)
+
+type SourceConfig struct {
+	Type      SourceType `mapstructure:"type"`       // Falls back to "display" when is_display is set, "device" otherwise
+	Width     int        `mapstructure:"width"`      // Generated sources only, falls back to frame_width
+	Height    int        `mapstructure:"height"`     // Generated sources only, falls back to frame_height
+	FrameRate int        `mapstructure:"frame_rate"` // Generated sources only, falls back to the camera frame_rate
+
+	Path       string       `mapstructure:"path"`        // File sources only, a video file, a directory or a glob of JPEG/PNG frames
+	Playback   PlaybackMode `mapstructure:"playback"`    // File sources only, "loop" (default) or "once"
+	NativeRate bool         `mapstructure:"native_rate"` // Video files only, play at the file's own rate instead of frame_rate. Image sequences reject it
+
+	URL          string        `mapstructure:"url"`           // Network sources only, rtsp:// or http(s):// depending on type
+	Username     string        `mapstructure:"username"`      // Network sources only
+	PasswordEnv  string        `mapstructure:"password_env"`  // Network sources only, read like access_key_env
+	Timeout      time.Duration `mapstructure:"timeout"`       // Network sources only, applies to connecting and to every frame, default 10s
+	ReconnectMin time.Duration `mapstructure:"reconnect_min"` // Network sources only, first reconnect delay, default 1s
+	ReconnectMax time.Duration `mapstructure:"reconnect_max"` // Network sources only, cap of the exponential backoff, default 30s
+}
+
 type CameraModeConfig struct {
 	Brightness     float64 `mapstructure:"brightness"`
 	Contrast       float64 `mapstructure:"contrast"`
@@ -27,6 +71,159 @@ type CameraModeConfig struct {
 	Quality        int     `mapstructure:"quality"`         // jpeg quality
 	OutFrameWidth  int     `mapstructure:"out_frame_width"` // Any value > 0 can be used
 	OutFrameHeight int     `mapstructure:"out_frame_height"`
+	Overlay        *bool   `mapstructure:"overlay"` // Draw detections on the output, default true
+}
+
+func (mc CameraModeConfig) DrawOverlay() bool {
+	return mc.Overlay == nil || *mc.Overlay
+}
+
+type ModelType string
+
+const (
+	ModelNone    ModelType = "none"
+	ModelCaffe   ModelType = "caffe"
+	ModelONNX    ModelType = "onnx"
+	ModelDarknet ModelType = "darknet"
+)
+
+type ModelOutput string
+
+const (
+	OutputSSD  ModelOutput = "ssd"  // [1, 1, N, 7] rows of image id, class id, confidence and a normalized box
+	OutputYOLO ModelOutput = "yolo" // [N, 5 + classes] rows of box center and size, objectness and class scores
+)
+
+type DetectionConfig struct {
+	Enabled     *bool         `mapstructure:"enabled"`      // Default true, cameras always ran detection before it was configurable
+	Interval    time.Duration `mapstructure:"interval"`     // Minimum time between two inference passes, 0 runs on every captured frame
+	Model       ModelType     `mapstructure:"model"`        // Empty falls back to MobileNet-SSD from MOBILENET_PROTOTXT and MOBILENET_MODEL
+	Output      ModelOutput   `mapstructure:"output"`       // Defaults to "ssd" for caffe and "yolo" otherwise
+	ModelPath   string        `mapstructure:"model_path"`   // .caffemodel, .onnx or .weights
+	ConfigPath  string        `mapstructure:"config_path"`  // .prototxt or .cfg, not used by onnx
+	LabelsPath  string        `mapstructure:"labels_path"`  // One label per line, line number is the class id
+	InputWidth  int           `mapstructure:"input_width"`  // Default 300
+	InputHeight int           `mapstructure:"input_height"` // Default 300
+	Mean        []float64     `mapstructure:"mean"`         // Subtracted per channel before scaling
+	Scale       float64       `mapstructure:"scale"`        // Default 1.0
+	SwapRB      bool          `mapstructure:"swap_rb"`
+	Classes     []string      `mapstructure:"classes"`    // Allow-list of labels, empty allows every class
+	Confidence  float32       `mapstructure:"confidence"` // Default 0.5
+
+	NMSThreshold float64       `mapstructure:"nms_threshold"` // Overlapping boxes of one label above this IoU are merged, default 0.45
+	TrackIoU     float64       `mapstructure:"track_iou"`     // Minimum IoU to continue a track, default 0.3
+	TrackTTL     time.Duration `mapstructure:"track_ttl"`     // Tracks unmatched for this long are dropped, default 2s
+}
+
+func (dc DetectionConfig) IsEnabled() bool {
+	return dc.Enabled == nil || *dc.Enabled
+}
+
+type MotionAlgorithm string
+
+const (
+	MotionMOG2 MotionAlgorithm = "mog2"
+	MotionKNN  MotionAlgorithm = "knn"
+)
+
+type MotionConfig struct {
+	Enabled     bool            `mapstructure:"enabled"`
+	Algorithm   MotionAlgorithm `mapstructure:"algorithm"`   // "mog2" (default) or "knn"
+	Sensitivity float64         `mapstructure:"sensitivity"` // 0..1, default 0.5
+	MinArea     int             `mapstructure:"min_area"`    // Smallest motion region in pixels of the analysed frame, default 200
+	Width       int             `mapstructure:"width"`       // Frames are downscaled to this width before analysis, default 320
+	Cooldown    time.Duration   `mapstructure:"cooldown"`    // Detection keeps running this long after the last motion, default 10s
+}
+
+type RecordingMode string
+
+const (
+	RecordingOff       RecordingMode = "off"
+	RecordingAlways    RecordingMode = "always"
+	RecordingScheduled RecordingMode = "scheduled"
+)
+
+type RecordingFormat string
+
+const (
+	RecordingAVI RecordingFormat = "avi" // MJPEG
+	RecordingMP4 RecordingFormat = "mp4" // MPEG-4 part 2
+)
+
+type ScheduleWindow struct {
+	Days  []string `mapstructure:"days"`  // "mon" to "sun", every day when empty
+	Start string   `mapstructure:"start"` // "15:04", a window ending before it starts runs overnight
+	End   string   `mapstructure:"end"`
+}
+
+type ClipConfig struct {
+	Enabled   bool          `mapstructure:"enabled"`
+	Triggers  []string      `mapstructure:"triggers"`   // Camera event types starting a clip, default entity_appeared, zone_entered, line_crossed and motion_started
+	PreRoll   time.Duration `mapstructure:"pre_roll"`   // Buffered time before the trigger, default 5s. Frames are kept decoded, 5s at 15fps of 640x480 take about 70MB per camera
+	PostRoll  time.Duration `mapstructure:"post_roll"`  // Recording continues this long after the last activity, default 10s
+	MaxLength time.Duration `mapstructure:"max_length"` // Longer activity is split into several clips, default 5m
+}
+
+type TimelapseConfig struct {
+	Enabled   bool          `mapstructure:"enabled"`
+	Interval  time.Duration `mapstructure:"interval"`   // One frame is sampled this often, default 10s
+	Period    time.Duration `mapstructure:"period"`     // Each timelapse covers this long starting at local midnight, default 24h
+	FrameRate int           `mapstructure:"frame_rate"` // Of the generated video, default 30
+}
+
+type RecordingConfig struct {
+	Mode          RecordingMode    `mapstructure:"mode"`           // "off" (default), "always" or "scheduled"
+	Schedule      []ScheduleWindow `mapstructure:"schedule"`       // Scheduled mode only
+	Format        RecordingFormat  `mapstructure:"format"`         // "avi" (default) or "mp4"
+	SegmentLength time.Duration    `mapstructure:"segment_length"` // Default 5m
+	FrameRate     int              `mapstructure:"frame_rate"`     // Falls back to the camera frame_rate
+	Clips         ClipConfig       `mapstructure:"clips"`          // Event triggered clips, independent of mode
+	Timelapse     TimelapseConfig  `mapstructure:"timelapse"`      // Independent of mode
+}
+
+type StreamLimitsConfig struct {
+	MaxFrameRate int  `mapstructure:"max_frame_rate"` // Upper bound for ?fps=, default the camera frame_rate
+	MinWidth     int  `mapstructure:"min_width"`      // Bounds for ?width=, default 160 up to the jpeg_stream width
+	MaxWidth     int  `mapstructure:"max_width"`
+	MinQuality   int  `mapstructure:"min_quality"` // Bounds for ?quality=, default 10 up to the jpeg_stream quality
+	MaxQuality   int  `mapstructure:"max_quality"`
+	MaxProfiles  int  `mapstructure:"max_profiles"` // Distinct profiles encoded at once, further ones get the shared output. Default 4
+	Adaptive     bool `mapstructure:"adaptive"`     // Lowers the quality of clients whose writes get slow
+}
+
+type HLSConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	SegmentLength time.Duration `mapstructure:"segment_length"` // Default 2s
+	WindowSize    int           `mapstructure:"window_size"`    // Segments listed in the playlist, default 5
+	Codec         string        `mapstructure:"codec"`          // ffmpeg encoder producing the MPEG-TS segments, default "libx264"
+	FrameRate     int           `mapstructure:"frame_rate"`     // Falls back to the camera frame_rate
+	IdleTimeout   time.Duration `mapstructure:"idle_timeout"`   // Encoding stops when nobody requested the playlist for this long, default 30s
+}
+
+type WebRTCConfig struct {
+	Enabled   bool `mapstructure:"enabled"`
+	Bitrate   int  `mapstructure:"bitrate"`    // VP8 target in kbit/s, default 1000
+	FrameRate int  `mapstructure:"frame_rate"` // Falls back to the camera frame_rate
+}
+
+type ZoneType string
+
+const (
+	ZoneMonitor ZoneType = "monitor"
+	ZoneInclude ZoneType = "include"
+	ZoneExclude ZoneType = "exclude"
+)
+
+type ZoneConfig struct {
+	Name   string       `mapstructure:"name" json:"name"`
+	Type   ZoneType     `mapstructure:"type" json:"type"`     // "monitor" (default), "include" or "exclude", detections outside every include zone are ignored
+	Points [][2]float64 `mapstructure:"points" json:"points"` // Polygon in normalized 0..1 coordinates of the captured frame
+}
+
+type LineConfig struct {
+	Name string     `mapstructure:"name" json:"name"`
+	From [2]float64 `mapstructure:"from" json:"from"` // Normalized 0..1 coordinates, crossings are reported relative to the From -> To direction
+	To   [2]float64 `mapstructure:"to" json:"to"`
 }
 
 type CameraConfig struct {
@@ -37,8 +234,18 @@ type CameraConfig struct {
 	FrameRate    int                             `mapstructure:"frame_rate"`
 	FrameWidth   int                             `mapstructure:"frame_width"` // Only values supported by the camera will be used
 	FrameHeight  int                             `mapstructure:"frame_height"`
+	Source       SourceConfig                    `mapstructure:"source"`
 	Modes        map[CameraMode]CameraModeConfig `mapstructure:"modes"`
-	IsDisplay    bool                            `mapstructure:"is_display"` // Streaming desktop doesn't work yet
+	Detection    DetectionConfig                 `mapstructure:"detection"`
+	Motion       MotionConfig                    `mapstructure:"motion"` // When enabled, detection only runs while there is motion
+	Recording    RecordingConfig                 `mapstructure:"recording"`
+	Stream       StreamLimitsConfig              `mapstructure:"stream"` // Limits of per-client ?fps=&width=&quality= on the jpeg_stream mode
+	HLS          HLSConfig                       `mapstructure:"hls"`    // Renders the jpeg_stream mode
+	WebRTC       WebRTCConfig                    `mapstructure:"webrtc"` // Renders the jpeg_stream mode
+	Zones        []ZoneConfig                    `mapstructure:"zones"`
+	Lines        []LineConfig                    `mapstructure:"lines"`
+	IdleTimeout  time.Duration                   `mapstructure:"idle_timeout"` // Stream clients that stop reading for this long are disconnected, default 30s
+	IsDisplay    bool                            `mapstructure:"is_display"`   // Streaming desktop doesn't work yet
 	DisplayIndex int                             `mapstructure:"display_index"`
 }
 
@@ -50,8 +257,49 @@ type DeviceConfig struct {
 	AccessKeyEnv string `mapstructure:"access_key_env"`
 }
 
+type EventsConfig struct {
+	Path          string        `mapstructure:"path"`           // bbolt database file, default "events.db"
+	MaxAge        time.Duration `mapstructure:"max_age"`        // Older events are deleted, default 720h, negative keeps them forever
+	MaxCount      int           `mapstructure:"max_count"`      // Only the newest events are kept, default 100000, negative keeps all
+	PruneInterval time.Duration `mapstructure:"prune_interval"` // How often retention is applied, default 1m
+}
+
+type SnapshotConfig struct {
+	Enabled        bool     `mapstructure:"enabled"`
+	Labels         []string `mapstructure:"labels"`          // Labels that trigger a snapshot when they first appear, default Car and Person
+	Quality        int      `mapstructure:"quality"`         // JPEG quality of snapshots and thumbnails, default 90
+	ThumbnailWidth int      `mapstructure:"thumbnail_width"` // Default 320
+}
+
+type MediaConfig struct {
+	Path      string         `mapstructure:"path"` // Directory for snapshots, default "media"
+	Snapshots SnapshotConfig `mapstructure:"snapshots"`
+}
+
+type RecordingsConfig struct {
+	Path          string        `mapstructure:"path"`           // Segments and their index, default "recordings"
+	MaxAge        time.Duration `mapstructure:"max_age"`        // Older segments are deleted, default 168h, negative keeps them forever
+	MaxBytes      int64         `mapstructure:"max_bytes"`      // Oldest segments are deleted above this total, default 50 GiB, negative disables
+	PruneInterval time.Duration `mapstructure:"prune_interval"` // How often retention is applied, default 1m
+	ExportTTL     time.Duration `mapstructure:"export_ttl"`     // Exported clips can be downloaded this long, default 24h
+	MaxExport     time.Duration `mapstructure:"max_export"`     // Longest range a single export may cover, default 1h
+}
+
+type StreamingConfig struct {
+	Path       string   `mapstructure:"path"`         // Scratch directory for HLS segments, default a directory in the system temp dir
+	FFmpegPath string   `mapstructure:"ffmpeg_path"`  // Used to encode WebRTC and HLS video, default "ffmpeg" from PATH
+	ICEServers []string `mapstructure:"ice_servers"`  // STUN/TURN URLs handed to WebRTC peers
+	PublicIPs  []string `mapstructure:"public_ips"`   // Advertised instead of local addresses, e.g. behind NAT or in docker
+	UDPPortMin uint16   `mapstructure:"udp_port_min"` // WebRTC media port range, any port when unset
+	UDPPortMax uint16   `mapstructure:"udp_port_max"`
+}
+
 type GlobalConfig struct {
-	API     APIConfig      `mapstructure:"api"`
-	Cameras []CameraConfig `mapstructure:"cameras"`
-	Devices []DeviceConfig `mapstructure:"devices"`
+	API        APIConfig        `mapstructure:"api"`
+	Cameras    []CameraConfig   `mapstructure:"cameras"`
+	Devices    []DeviceConfig   `mapstructure:"devices"`
+	Events     EventsConfig     `mapstructure:"events"`
+	Media      MediaConfig      `mapstructure:"media"`
+	Recordings RecordingsConfig `mapstructure:"recordings"`
+	Streaming  StreamingConfig  `mapstructure:"streaming"`
 }
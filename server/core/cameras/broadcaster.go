@@ -0,0 +1,321 @@
+// core/cameras/broadcaster.go
+package cameras
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Values that hold resources, such as frames, are acquired once for every
+// subscriber they are handed to and released when they are dropped.
+type sharedValue interface {
+	acquire()
+	Release()
+}
+
+func acquireValue[T any](v T) {
+	if shared, ok := any(v).(sharedValue); ok {
+		shared.acquire()
+	}
+}
+
+func releaseValue[T any](v T) {
+	if shared, ok := any(v).(sharedValue); ok {
+		shared.Release()
+	}
+}
+
+type SubscriberStats struct {
+	ID          uint64    `json:"id"`
+	Delivered   uint64    `json:"delivered"`
+	Dropped     uint64    `json:"dropped"`
+	ConnectedAt time.Time `json:"connected_at"`
+	LastActive  time.Time `json:"last_active"`
+}
+
+type BroadcasterStats struct {
+	Subscribers int               `json:"subscribers"`
+	Published   uint64            `json:"published"`
+	Clients     []SubscriberStats `json:"clients"`
+}
+
+type Subscriber[T any] struct {
+	id          uint64
+	ch          chan T
+	done        chan struct{}
+	closeOnce   sync.Once
+	delivered   atomic.Uint64
+	dropped     atomic.Uint64
+	connectedAt time.Time
+	lastActive  atomic.Int64
+	broadcaster *Broadcaster[T]
+}
+
+// Waits for the next value. Returns false once the subscriber was closed,
+// disconnected for being idle, or cancel fired. A subscriber counts as active
+// both while waiting and when it receives, so handling a value after a quiet
+// period does not make it look idle.
+func (s *Subscriber[T]) Next(cancel <-chan struct{}) (T, bool) {
+	s.lastActive.Store(time.Now().UnixNano())
+
+	select {
+	case v := <-s.ch:
+		s.lastActive.Store(time.Now().UnixNano())
+		s.delivered.Add(1)
+		return v, true
+	case <-s.done:
+	case <-cancel:
+	}
+
+	var zero T
+	return zero, false
+}
+
+func (s *Subscriber[T]) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Subscriber[T]) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+func (s *Subscriber[T]) Close() {
+	s.broadcaster.unsubscribe(s)
+}
+
+func (s *Subscriber[T]) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		for {
+			select {
+			case v := <-s.ch:
+				releaseValue(v)
+			default:
+				return
+			}
+		}
+	})
+}
+
+// A slow subscriber never blocks Publish, its oldest pending value makes room
+// for the newer one and is counted as dropped.
+func (s *Subscriber[T]) offer(v T) {
+	acquireValue(v)
+
+	for {
+		select {
+		case s.ch <- v:
+			return
+		default:
+		}
+
+		select {
+		case old := <-s.ch:
+			releaseValue(old)
+			s.dropped.Add(1)
+		default:
+		}
+	}
+}
+
+func (s *Subscriber[T]) isIdle(timeout time.Duration) bool {
+	lastActive := time.Unix(0, s.lastActive.Load())
+	return len(s.ch) > 0 && time.Since(lastActive) > timeout
+}
+
+func (s *Subscriber[T]) stats() SubscriberStats {
+	return SubscriberStats{
+		ID:          s.id,
+		Delivered:   s.delivered.Load(),
+		Dropped:     s.dropped.Load(),
+		ConnectedAt: s.connectedAt,
+		LastActive:  time.Unix(0, s.lastActive.Load()),
+	}
+}
+
+type Broadcaster[T any] struct {
+	subs        map[uint64]*Subscriber[T]
+	bufferSize  int
+	replayLast  bool
+	nextID      uint64
+	last        T
+	hasLast     bool
+	published   uint64
+	idleTimeout time.Duration
+	closed      bool
+	stop        chan struct{}
+	mu          sync.RWMutex
+}
+
+// Every subscriber only ever holds the newest value and immediately receives
+// the last published one. An idleTimeout of 0 never disconnects subscribers.
+func NewBroadcaster[T any](idleTimeout time.Duration) *Broadcaster[T] {
+	return newBroadcaster[T](idleTimeout, 1, true)
+}
+
+// Every subscriber buffers up to size values, the oldest is dropped once the
+// buffer is full. Nothing is replayed to new subscribers.
+func NewQueueBroadcaster[T any](idleTimeout time.Duration, size int) *Broadcaster[T] {
+	if size < 1 {
+		size = 1
+	}
+	return newBroadcaster[T](idleTimeout, size, false)
+}
+
+func newBroadcaster[T any](idleTimeout time.Duration, bufferSize int, replayLast bool) *Broadcaster[T] {
+	b := &Broadcaster[T]{
+		subs:        make(map[uint64]*Subscriber[T]),
+		bufferSize:  bufferSize,
+		replayLast:  replayLast,
+		idleTimeout: idleTimeout,
+		stop:        make(chan struct{}),
+	}
+
+	if idleTimeout > 0 {
+		go b.reapIdle()
+	}
+
+	return b
+}
+
+// New subscribers immediately receive the last published value, if any.
+func (b *Broadcaster[T]) Subscribe() *Subscriber[T] {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	sub := &Subscriber[T]{
+		id:          b.nextID,
+		ch:          make(chan T, b.bufferSize),
+		done:        make(chan struct{}),
+		connectedAt: time.Now(),
+		broadcaster: b,
+	}
+	sub.lastActive.Store(sub.connectedAt.UnixNano())
+
+	if b.closed {
+		sub.close()
+		return sub
+	}
+
+	if b.replayLast && b.hasLast {
+		sub.offer(b.last)
+	}
+	b.subs[sub.id] = sub
+
+	return sub
+}
+
+func (b *Broadcaster[T]) unsubscribe(sub *Subscriber[T]) {
+	b.mu.Lock()
+	delete(b.subs, sub.id)
+	b.mu.Unlock()
+
+	sub.close()
+}
+
+// Takes ownership of one reference to v.
+func (b *Broadcaster[T]) Publish(v T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		releaseValue(v)
+		return
+	}
+
+	if b.hasLast {
+		releaseValue(b.last)
+	}
+	b.last = v
+	b.hasLast = true
+	b.published++
+
+	for _, sub := range b.subs {
+		sub.offer(v)
+	}
+}
+
+// Returns the last published value, shared values must be released by the caller.
+func (b *Broadcaster[T]) Latest() (T, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.hasLast {
+		acquireValue(b.last)
+	}
+	return b.last, b.hasLast
+}
+
+func (b *Broadcaster[T]) SubscriberCount() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return len(b.subs)
+}
+
+func (b *Broadcaster[T]) Stats() BroadcasterStats {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	stats := BroadcasterStats{
+		Subscribers: len(b.subs),
+		Published:   b.published,
+		Clients:     make([]SubscriberStats, 0, len(b.subs)),
+	}
+	for _, sub := range b.subs {
+		stats.Clients = append(stats.Clients, sub.stats())
+	}
+	sort.Slice(stats.Clients, func(i, j int) bool {
+		return stats.Clients[i].ID < stats.Clients[j].ID
+	})
+
+	return stats
+}
+
+func (b *Broadcaster[T]) reapIdle() {
+	ticker := time.NewTicker(b.idleTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		}
+
+		b.mu.Lock()
+		for id, sub := range b.subs {
+			if sub.isIdle(b.idleTimeout) {
+				delete(b.subs, id)
+				sub.close()
+			}
+		}
+		b.mu.Unlock()
+	}
+}
+
+func (b *Broadcaster[T]) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+	close(b.stop)
+
+	for id, sub := range b.subs {
+		delete(b.subs, id)
+		sub.close()
+	}
+
+	if b.hasLast {
+		releaseValue(b.last)
+		var zero T
+		b.last = zero
+		b.hasLast = false
+	}
+}
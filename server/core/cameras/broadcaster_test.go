@@ -0,0 +1,61 @@
+// core/cameras/broadcaster_test.go
+package cameras
+
+import (
+	"testing"
+	"time"
+)
+
+// A consumer that waited through a quiet period and is still handling a value
+// when the next one is queued must not be reaped as idle.
+func TestSubscriberSurvivesBurstAfterQuietPeriod(t *testing.T) {
+	const idleTimeout = 200 * time.Millisecond
+
+	b := NewQueueBroadcaster[int](idleTimeout, 4)
+	defer b.Close()
+
+	sub := b.Subscribe()
+	defer sub.Close()
+
+	go func() {
+		time.Sleep(3 * idleTimeout)
+		b.Publish(1)
+		time.Sleep(idleTimeout / 4)
+		b.Publish(2)
+	}()
+
+	stop := make(chan struct{})
+	if v, ok := sub.Next(stop); !ok || v != 1 {
+		t.Fatalf("expected 1, got %d (ok=%v)", v, ok)
+	}
+
+	// Handling the value takes a while but less than the idle timeout, the
+	// reaper ticks meanwhile with the second value queued
+	time.Sleep(idleTimeout * 3 / 4)
+
+	select {
+	case <-sub.Done():
+		t.Fatal("subscriber was reaped while handling a value")
+	default:
+	}
+
+	if v, ok := sub.Next(stop); !ok || v != 2 {
+		t.Fatalf("expected 2, got %d (ok=%v)", v, ok)
+	}
+}
+
+func TestSubscriberReapedWhenStalled(t *testing.T) {
+	const idleTimeout = 100 * time.Millisecond
+
+	b := NewQueueBroadcaster[int](idleTimeout, 4)
+	defer b.Close()
+
+	sub := b.Subscribe()
+	b.Publish(1)
+
+	select {
+	case <-sub.Done():
+	case <-time.After(5 * idleTimeout):
+		t.Fatal("stalled subscriber was not reaped")
+	}
+}
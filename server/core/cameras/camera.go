@@ -2,66 +2,105 @@
 package cameras
 
 import (
+	"errors"
 	"fmt"
 	"image"
+	"io"
 	"os"
 	"sync"
 	"time"
 
 	"smuggr.xyz/gatecam/common/config"
 
-	"github.com/kbinani/screenshot"
 	"gocv.io/x/gocv"
 )
 
+const defaultIdleTimeout = 30 * time.Second
+
 type Entity struct {
-	Rect       image.Rectangle
-	Confidence float32
-	Label      string
-	Timestamp  time.Time
+	TrackID    uint64          `json:"track_id"`
+	Rect       image.Rectangle `json:"rect"`
+	Confidence float32         `json:"confidence"`
+	Label      string          `json:"label"`
+	Timestamp  time.Time       `json:"timestamp"`
+	FirstSeen  time.Time       `json:"first_seen"`
+	LastSeen   time.Time       `json:"last_seen"`
+	Velocity   Velocity        `json:"velocity"` // Pixels per second in source frame coordinates
+	Direction  Direction       `json:"direction"`
+	Zones      []string        `json:"zones,omitempty"`
 }
 
 type CameraModeOutput struct {
-	lastFrame []byte
-	lastErr   error
-	config    config.CameraModeConfig
+	lastFrame   []byte
+	lastErr     error
+	config      config.CameraModeConfig
+	broadcaster *Broadcaster[*EncodedFrame]
+}
+
+type DetectionStatus struct {
+	Enabled bool             `json:"enabled"`
+	Model   config.ModelType `json:"model,omitempty"`
+	Error   string           `json:"error,omitempty"`
+}
+
+type CameraStats struct {
+	Name       string                                 `json:"name"`
+	Source     config.SourceType                      `json:"source"`
+	Connected  bool                                   `json:"connected"`
+	Width      int                                    `json:"width"`
+	Height     int                                    `json:"height"`
+	FrameSeq   uint64                                 `json:"frame_seq"`
+	Detection  DetectionStatus                        `json:"detection"`
+	Motion     *MotionState                           `json:"motion,omitempty"`
+	Detections int                                    `json:"detections"`
+	Modes      map[config.CameraMode]BroadcasterStats `json:"modes"`
+	Profiles   map[string]BroadcasterStats            `json:"profiles,omitempty"` // Per-client jpeg_stream encoders
 }
 
 type Camera struct {
 	Name        string
 	Device      int
 	Order       uint
-	capture     *gocv.VideoCapture
+	source      FrameSource
 	mu          sync.Mutex
 	running     bool
+	stop        chan struct{}
+	wg          sync.WaitGroup
 	config      config.CameraConfig
+	frames      *Broadcaster[*Frame]
+	preRoll     *FrameRing
+	events      *Broadcaster[Event]
+	frameSeq    uint64
+	epoch       int64 // Frame sequence numbers restart with every camera instance
 	detections  []Entity
 	detectionMu sync.Mutex
-	net         gocv.Net
+	detector    Detector
+	detection   DetectionStatus
+	tracker     *Tracker
+	motion      *MotionDetector
+	zones       *ZoneSet
 	outputs     map[config.CameraMode]CameraModeOutput
+	profiles    map[StreamProfile]*profileEncoder
 }
 
 func NewCamera(camConfig config.CameraConfig) (*Camera, error) {
-	var cap *gocv.VideoCapture
-	var err error
-
-	if !camConfig.IsDisplay {
-		cap, err = gocv.OpenVideoCapture(camConfig.Device)
-		if err != nil {
-			return nil, fmt.Errorf("error opening camera %d: %v", camConfig.Device, err)
-		}
+	source, err := NewFrameSource(camConfig)
+	if err != nil {
+		return nil, err
+	}
 
-		if camConfig.FrameWidth > 0 {
-			cap.Set(gocv.VideoCaptureFrameWidth, float64(camConfig.FrameWidth))
-		}
-		if camConfig.FrameHeight > 0 {
-			cap.Set(gocv.VideoCaptureFrameHeight, float64(camConfig.FrameHeight))
-		}
+	zones, err := NewZoneSet(camConfig.Zones, camConfig.Lines)
+	if err != nil {
+		source.Close()
+		return nil, err
 	}
 
-	net := gocv.ReadNetFromCaffe(os.Getenv("MOBILENET_PROTOTXT"), os.Getenv("MOBILENET_MODEL"))
-	if net.Empty() {
-		return nil, fmt.Errorf("error loading MobileNet-SSD model")
+	detector, detection := newCameraDetector(camConfig)
+	motion := newCameraMotion(camConfig)
+
+	idleTimeout := camConfig.IdleTimeout
+	if idleTimeout <= 0 {
+		idleTimeout = defaultIdleTimeout
 	}
 
 	outputs := make(map[config.CameraMode]CameraModeOutput)
@@ -72,177 +111,447 @@ func NewCamera(camConfig config.CameraConfig) (*Camera, error) {
 		if mode.OutFrameHeight == 0 {
 			mode.OutFrameHeight = camConfig.FrameHeight
 		}
-		outputs[camMode] = CameraModeOutput{config: mode}
+		outputs[camMode] = CameraModeOutput{
+			config:      mode,
+			broadcaster: NewBroadcaster[*EncodedFrame](idleTimeout),
+		}
+	}
+
+	var preRoll *FrameRing
+	if clipConfig := camConfig.Recording.Clips; clipConfig.Enabled {
+		preRoll = NewFrameRing(ClipPreRoll(clipConfig), RecordingFrameRate(camConfig))
 	}
 
 	return &Camera{
 		Name:       camConfig.Name,
 		Device:     camConfig.Device,
-		capture:    cap,
+		source:     source,
 		config:     camConfig,
-		net:        net,
+		detector:   detector,
+		detection:  detection,
+		tracker:    NewTracker(camConfig.Detection),
+		motion:     motion,
+		zones:      zones,
+		frames:     NewBroadcaster[*Frame](0),
+		preRoll:    preRoll,
+		events:     NewQueueBroadcaster[Event](idleTimeout, eventQueueSize),
 		detections: []Entity{},
+		epoch:      time.Now().UnixNano(),
 		outputs:    outputs,
+		profiles:   make(map[StreamProfile]*profileEncoder),
 	}, nil
 }
 
+// A camera never fails to start because of its model, detection is reported
+// as disabled instead.
+func newCameraDetector(camConfig config.CameraConfig) (Detector, DetectionStatus) {
+	if !camConfig.Detection.IsEnabled() {
+		return noopDetector{}, DetectionStatus{Enabled: false}
+	}
+
+	detConfig := withDetectionDefaults(camConfig.Detection)
+	detector, err := NewDetector(detConfig)
+	if err != nil {
+		fmt.Printf("camera %s runs without detection: %v\n", camConfig.Name, err)
+		return noopDetector{}, DetectionStatus{Enabled: false, Model: detConfig.Model, Error: err.Error()}
+	}
+
+	return detector, DetectionStatus{Enabled: true, Model: detConfig.Model}
+}
+
+// Like detection, a camera whose motion detector cannot be built keeps
+// running with detection ungated.
+func newCameraMotion(camConfig config.CameraConfig) *MotionDetector {
+	if !camConfig.Motion.Enabled {
+		return nil
+	}
+
+	motion, err := NewMotionDetector(camConfig.Motion)
+	if err != nil {
+		fmt.Printf("camera %s runs without motion detection: %v\n", camConfig.Name, err)
+		return nil
+	}
+
+	return motion
+}
+
 func (cam *Camera) GetAccessKey() string {
 	return os.Getenv(cam.config.AccessKeyEnv)
 }
 
-func (cam *Camera) grabScreenMat() (*gocv.Mat, error) {
-	displayIndex := cam.config.DisplayIndex
-	bounds := screenshot.GetDisplayBounds(displayIndex)
-	if bounds.Empty() {
-		return nil, fmt.Errorf("invalid display bounds for index %d", displayIndex)
+func (cam *Camera) captureFrames(frameRate int) {
+	defer cam.wg.Done()
+
+	if frameRate <= 0 {
+		frameRate = 30
 	}
+	ticker := time.NewTicker(time.Second / time.Duration(frameRate))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cam.stop:
+			return
+		case <-ticker.C:
+		}
 
-	img, err := screenshot.CaptureRect(bounds)
-	if err != nil {
-		return nil, fmt.Errorf("failed to capture display %d: %v", displayIndex, err)
+		mat := gocv.NewMat()
+		if err := cam.source.Read(&mat); err != nil {
+			mat.Close()
+			if !errors.Is(err, io.EOF) {
+				fmt.Printf("camera %s failed to read frame: %v\n", cam.Name, err)
+			}
+			continue
+		}
+
+		cam.publishFrame(mat)
 	}
+}
 
-	matRGB, err := gocv.ImageToMatRGB(img)
-	if err != nil {
-		return nil, fmt.Errorf("failed to convert screenshot to Mat: %v", err)
+// Changes whenever frame sequence numbers restart, so together with the
+// sequence it identifies a frame across server restarts.
+func (cam *Camera) Epoch() int64 {
+	return cam.epoch
+}
+
+func (cam *Camera) publishFrame(mat gocv.Mat) {
+	cam.frameSeq++
+	frame := newFrame(mat, cam.frameSeq, cam.Detections())
+	if cam.preRoll != nil {
+		cam.preRoll.Push(frame)
 	}
-	defer matRGB.Close()
+	cam.frames.Publish(frame)
+}
+
+// Frames buffered before now for clips, nil when clips are disabled. Every
+// frame must be released.
+func (cam *Camera) PreRoll() []*Frame {
+	if cam.preRoll == nil {
+		return nil
+	}
+	return cam.preRoll.Frames()
+}
 
-	matBGR := gocv.NewMat()
-	gocv.CvtColor(matRGB, &matBGR, gocv.ColorRGBToBGR)
+// Returns the most recent captured frame or nil, the caller must Release it.
+func (cam *Camera) LatestFrame() *Frame {
+	frame, ok := cam.frames.Latest()
+	if !ok {
+		return nil
+	}
+	return frame
+}
 
-	return &matBGR, nil
+// Raw frames as they are captured, every received frame must be released.
+func (cam *Camera) SubscribeFrames() *Subscriber[*Frame] {
+	return cam.frames.Subscribe()
 }
 
-func (cam *Camera) grabFrame(mode config.CameraMode) ([]byte, error) {
+func (cam *Camera) Subscribe(mode config.CameraMode) (*Subscriber[*EncodedFrame], error) {
+	cam.mu.Lock()
+	output, ok := cam.outputs[mode]
+	cam.mu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("camera %s has no %s mode", cam.Name, mode)
+	}
+
+	return output.broadcaster.Subscribe(), nil
+}
+
+func (cam *Camera) Stats() CameraStats {
+	width, height := cam.source.Resolution()
+	stats := CameraStats{
+		Name:       cam.Name,
+		Source:     resolveSourceType(cam.config),
+		Connected:  cam.source.IsOpened(),
+		Width:      width,
+		Height:     height,
+		Detection:  cam.detection,
+		Detections: len(cam.Detections()),
+		Modes:      make(map[config.CameraMode]BroadcasterStats),
+	}
+
+	if motion, ok := cam.Motion(); ok {
+		stats.Motion = &motion
+	}
+
+	if frame := cam.LatestFrame(); frame != nil {
+		stats.FrameSeq = frame.Seq
+		frame.Release()
+	}
+
 	cam.mu.Lock()
 	defer cam.mu.Unlock()
 
-	var mat *gocv.Mat
-	var err error
+	for mode, output := range cam.outputs {
+		stats.Modes[mode] = output.broadcaster.Stats()
+	}
+
+	if len(cam.profiles) > 0 {
+		stats.Profiles = make(map[string]BroadcasterStats, len(cam.profiles))
+		for profile, enc := range cam.profiles {
+			stats.Profiles[profile.String()] = enc.broadcaster.Stats()
+		}
+	}
+
+	return stats
+}
+
+func (cam *Camera) Detections() []Entity {
+	cam.detectionMu.Lock()
+	defer cam.detectionMu.Unlock()
+
+	detections := make([]Entity, len(cam.detections))
+	copy(detections, cam.detections)
+	return detections
+}
 
-	if cam.config.IsDisplay {
-		mat, err = cam.grabScreenMat()
+func (cam *Camera) detectFrames(sub *Subscriber[*Frame]) {
+	defer cam.wg.Done()
+	defer sub.Close()
+
+	var lastRun time.Time
+	for {
+		frame, ok := sub.Next(cam.stop)
+		if !ok {
+			return
+		}
+
+		if wait := cam.config.Detection.Interval - time.Since(lastRun); wait > 0 {
+			frame.Release()
+
+			select {
+			case <-cam.stop:
+				return
+			case <-time.After(wait):
+			}
+
+			if frame = cam.LatestFrame(); frame == nil {
+				continue
+			}
+		}
+
+		// A static scene keeps the last detections and tracks until motion returns
+		if cam.motion != nil && !cam.motion.Active() {
+			frame.Release()
+			continue
+		}
+
+		lastRun = time.Now()
+		width, height := frame.Mat.Cols(), frame.Mat.Rows()
+		detections, err := cam.detector.Detect(frame.Mat)
 		if err != nil {
-			fmt.Printf("camera %s failed to capture screen: %v\n", cam.Name, err)
-			return nil, nil
+			frame.Release()
+			fmt.Printf("camera %s failed to detect objects: %v\n", cam.Name, err)
+			continue
 		}
-	} else {
-		if cam.capture == nil || !cam.capture.IsOpened() {
-			fmt.Printf("camera %s is not initialized or disconnected\n", cam.Name)
-			cam.checkAndRecoverCamera()
-			return nil, nil
+
+		detections = cam.zones.Filter(detections, width, height)
+		detections, appeared, disappeared := cam.tracker.Update(detections, lastRun)
+		detections, zoneEvents := cam.zones.Update(detections, disappeared, width, height, lastRun)
+		for i := range appeared {
+			for _, det := range detections {
+				if det.TrackID == appeared[i].TrackID {
+					appeared[i] = det
+				}
+			}
 		}
 
-		tmpMat := gocv.NewMat()
-		mat = &tmpMat
-		if !cam.capture.Read(mat) || mat.Empty() {
-			fmt.Printf("camera %s failed to read frame\n", cam.Name)
-			return nil, nil
+		var snapshot *Snapshot
+		if cam.wantsSnapshot(appeared) {
+			if snapshot, err = cam.takeSnapshot(frame.Mat, detections, lastRun); err != nil {
+				fmt.Printf("camera %s failed to take snapshot: %v\n", cam.Name, err)
+			}
 		}
+		frame.Release()
+
+		cam.publishTrackEvents(appeared, disappeared, snapshot, lastRun)
+		cam.publishEvents(zoneEvents)
+
+		cam.detectionMu.Lock()
+		cam.detections = detections
+		cam.detectionMu.Unlock()
 	}
-	defer mat.Close()
+}
+
+func (cam *Camera) encodeFrames(mode config.CameraMode, sub *Subscriber[*Frame]) {
+	defer cam.wg.Done()
+	defer sub.Close()
+
+	for {
+		frame, ok := sub.Next(cam.stop)
+		if !ok {
+			return
+		}
+
+		data, size, err := cam.encodeFrame(frame, mode)
+		encoded := &EncodedFrame{
+			Data:       data,
+			Seq:        frame.Seq,
+			Timestamp:  frame.Timestamp,
+			Width:      size.X,
+			Height:     size.Y,
+			Detections: frame.Detections,
+		}
+		frame.Release()
+
+		cam.mu.Lock()
+		output := cam.outputs[mode]
+		output.lastFrame = data
+		output.lastErr = err
+		cam.outputs[mode] = output
+		cam.mu.Unlock()
+
+		if err == nil {
+			output.broadcaster.Publish(encoded)
+		}
+	}
+}
+
+// Applies the post-processing and overlays of a mode to a copy of the frame,
+// the returned Mat must be closed.
+func (cam *Camera) Render(frame *Frame, mode config.CameraMode) gocv.Mat {
+	return cam.render(frame, mode, cam.config.Modes[mode].DrawOverlay())
+}
+
+func (cam *Camera) render(frame *Frame, mode config.CameraMode, overlay bool) gocv.Mat {
+	mat := frame.Mat.Clone()
 
 	modeConfig := cam.config.Modes[mode]
-	cam.applyPostProcessing(mat, modeConfig)
+	srcWidth, srcHeight := mat.Cols(), mat.Rows()
+	cam.applyPostProcessing(&mat, modeConfig)
+
+	if overlay {
+		detections := make([]Entity, len(frame.Detections))
+		for i, det := range frame.Detections {
+			det.Rect = mapRect(det.Rect, srcWidth, srcHeight, modeConfig)
+			detections[i] = det
+		}
+		cam.drawDetections(&mat, detections)
 
-	detections := cam.detectObjects(*mat)
-	cam.detectionMu.Lock()
-	cam.detections = detections
-	cam.detectionMu.Unlock()
+		if mode == config.ModeJPEGStream {
+			cam.zones.draw(&mat, srcWidth, srcHeight, modeConfig)
+		}
+	}
+
+	return mat
+}
+
+func (cam *Camera) encodeFrame(frame *Frame, mode config.CameraMode) ([]byte, image.Point, error) {
+	mat := cam.Render(frame, mode)
+	defer mat.Close()
 
-	cam.drawDetections(mat, detections)
+	size := image.Pt(mat.Cols(), mat.Rows())
+	modeConfig := cam.config.Modes[mode]
 
+	var data []byte
+	var err error
 	switch mode {
 	case config.ModeGrayscaleFrame:
-		return cam.grabFrameGrayscale(*mat)
+		data, err = cam.grabFrameGrayscale(mat)
 	case config.ModeColorFrame:
-		return cam.grabFrameRGB565(*mat)
+		data, err = cam.grabFrameRGB565(mat)
 	case config.ModeJPEGStream:
-		return cam.grabFrameJPEG(*mat, modeConfig)
+		data, err = cam.grabFrameJPEG(mat, modeConfig)
 	default:
-		return nil, fmt.Errorf("unsupported camera mode: %s", mode)
+		err = fmt.Errorf("unsupported camera mode: %s", mode)
 	}
+	return data, size, err
 }
 
-func (cam *Camera) streamFrames(frameRate int) {
-	interval := time.Duration(1000/frameRate) * time.Millisecond
-	var wg sync.WaitGroup
+type JPEGOptions struct {
+	Width   int // With only one side set the other follows the aspect ratio, with both the frame fits inside
+	Height  int
+	Quality int   // 0 keeps the jpeg_stream quality
+	Overlay *bool // nil keeps the jpeg_stream setting
+}
 
-	for mode, output := range cam.outputs {
-		wg.Add(1)
-		go func(mode config.CameraMode, output CameraModeOutput) {
-			defer wg.Done()
-			ticker := time.NewTicker(interval)
-			defer ticker.Stop()
-
-			for {
-				cam.mu.Lock()
-				if !cam.running {
-					cam.mu.Unlock()
-					break
-				}
-				cam.mu.Unlock()
-
-				<-ticker.C
-				frame, err := cam.grabFrame(mode)
-
-				cam.mu.Lock()
-				if err != nil {
-					cam.outputs[mode] = CameraModeOutput{
-						lastFrame: nil,
-						lastErr:   err,
-						config:    output.config,
-					}
-				} else {
-					cam.outputs[mode] = CameraModeOutput{
-						lastFrame: frame,
-						lastErr:   nil,
-						config:    output.config,
-					}
-				}
-				cam.mu.Unlock()
-			}
-		}(mode, output)
+// Largest size of the given aspect that fits the requested box.
+func fitSize(width, height int, opts JPEGOptions) image.Point {
+	switch {
+	case opts.Width <= 0 && opts.Height <= 0:
+		return image.Pt(width, height)
+	case opts.Height <= 0:
+		return image.Pt(opts.Width, max(1, height*opts.Width/width))
+	case opts.Width <= 0:
+		return image.Pt(max(1, width*opts.Height/height), opts.Height)
 	}
 
-	wg.Wait()
+	if width*opts.Height > height*opts.Width {
+		return image.Pt(opts.Width, max(1, height*opts.Width/width))
+	}
+	return image.Pt(max(1, width*opts.Height/height), opts.Height)
 }
 
-func (cam *Camera) SetDesiredResolution(width, height int) {
-	if cam.config.IsDisplay {
-		cam.config.FrameWidth = width
-		cam.config.FrameHeight = height
-		fmt.Printf("SetDesiredResolution() called on display cam %s. Updated config only.\n", cam.Name)
-		return
+// Renders a frame like the jpeg_stream mode but sized and encoded for a single
+// client instead of the shared output.
+func (cam *Camera) EncodeJPEG(frame *Frame, opts JPEGOptions) (*EncodedFrame, error) {
+	modeConfig := cam.config.Modes[config.ModeJPEGStream]
+	if opts.Quality > 0 {
+		modeConfig.Quality = opts.Quality
 	}
 
-	if cam.capture != nil && cam.capture.IsOpened() {
-		if width > 0 {
-			cam.capture.Set(gocv.VideoCaptureFrameWidth, float64(width))
-		}
-		if height > 0 {
-			cam.capture.Set(gocv.VideoCaptureFrameHeight, float64(height))
-		}
+	overlay := modeConfig.DrawOverlay()
+	if opts.Overlay != nil {
+		overlay = *opts.Overlay
+	}
+
+	mat := cam.render(frame, config.ModeJPEGStream, overlay)
+	defer mat.Close()
+
+	size := fitSize(mat.Cols(), mat.Rows(), opts)
+	if size.X != mat.Cols() || size.Y != mat.Rows() {
+		gocv.Resize(mat, &mat, size, 0, 0, gocv.InterpolationArea)
 	}
+
+	data, err := cam.grabFrameJPEG(mat, modeConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EncodedFrame{
+		Data:       data,
+		Seq:        frame.Seq,
+		Timestamp:  frame.Timestamp,
+		Width:      size.X,
+		Height:     size.Y,
+		Detections: frame.Detections,
+	}, nil
+}
+
+func (cam *Camera) SetDesiredResolution(width, height int) {
+	cam.source.SetResolution(width, height)
 }
 
 func (cam *Camera) GetActualResolution() (float64, float64) {
-	if cam.config.IsDisplay {
-		bounds := screenshot.GetDisplayBounds(cam.config.DisplayIndex)
-		if bounds.Empty() {
-			return float64(cam.config.FrameWidth), float64(cam.config.FrameHeight)
-		}
-		return float64(bounds.Dx()), float64(bounds.Dy())
+	w, h := cam.source.Resolution()
+	return float64(w), float64(h)
+}
+
+func (cam *Camera) Zones() ([]config.ZoneConfig, []config.LineConfig) {
+	return cam.zones.Get()
+}
+
+func (cam *Camera) SetZones(zones []config.ZoneConfig, lines []config.LineConfig) error {
+	return cam.zones.Set(zones, lines)
+}
+
+func (cam *Camera) Seek(position time.Duration) error {
+	source, ok := cam.source.(SeekableSource)
+	if !ok {
+		return fmt.Errorf("camera %s source does not support seeking", cam.Name)
 	}
 
-	if cam.capture != nil && cam.capture.IsOpened() {
-		w := cam.capture.Get(gocv.VideoCaptureFrameWidth)
-		h := cam.capture.Get(gocv.VideoCaptureFrameHeight)
-		return w, h
+	return source.Seek(position)
+}
+
+func (cam *Camera) PlaybackPosition() (time.Duration, time.Duration, bool) {
+	source, ok := cam.source.(SeekableSource)
+	if !ok {
+		return 0, 0, false
 	}
 
-	return 0, 0
+	return source.Position(), source.Duration(), true
 }
 
 func (cam *Camera) ReadFrame(mode config.CameraMode) ([]byte, error) {
@@ -261,25 +570,64 @@ func (cam *Camera) ReadFrame(mode config.CameraMode) ([]byte, error) {
 
 func (cam *Camera) Start(frameRate int) {
 	cam.mu.Lock()
+	defer cam.mu.Unlock()
+
 	if cam.running {
-		cam.mu.Unlock()
 		return
 	}
 	cam.running = true
-	cam.mu.Unlock()
+	cam.stop = make(chan struct{})
+
+	if cam.detection.Enabled {
+		cam.wg.Add(1)
+		go cam.detectFrames(cam.frames.Subscribe())
+	}
+
+	if cam.motion != nil {
+		cam.wg.Add(1)
+		go cam.detectMotion(cam.frames.Subscribe())
+	}
 
-	go cam.streamFrames(frameRate)
+	for mode := range cam.outputs {
+		cam.wg.Add(1)
+		go cam.encodeFrames(mode, cam.frames.Subscribe())
+	}
+
+	cam.wg.Add(1)
+	go cam.captureFrames(frameRate)
 }
 
 func (cam *Camera) Stop() {
 	cam.mu.Lock()
+	wasRunning := cam.running
 	cam.running = false
 	cam.mu.Unlock()
 
-	if cam.capture != nil {
-		cam.capture.Close()
-		cam.capture = nil
+	if wasRunning {
+		close(cam.stop)
+	}
+
+	// Closing the source first unblocks a capture loop waiting on a read
+	if err := cam.source.Close(); err != nil {
+		fmt.Printf("error closing source of camera %s: %v\n", cam.Name, err)
+	}
+	cam.wg.Wait()
+
+	cam.frames.Close()
+	cam.events.Close()
+	if cam.preRoll != nil {
+		cam.preRoll.Close()
+	}
+	for _, output := range cam.outputs {
+		output.broadcaster.Close()
 	}
 
-	cam.net.Close()
+	if err := cam.detector.Close(); err != nil {
+		fmt.Printf("error closing detector of camera %s: %v\n", cam.Name, err)
+	}
+	if cam.motion != nil {
+		if err := cam.motion.Close(); err != nil {
+			fmt.Printf("error closing motion detector of camera %s: %v\n", cam.Name, err)
+		}
+	}
 }
@@ -23,15 +23,18 @@ func loadCameras() {
 		cam.Start(camConfig.FrameRate)
 
 		fmt.Printf("========================================\n")
-		fmt.Printf("Loaded and started camera: %s -> %d\n", camConfig.Name, camConfig.Device)
+		fmt.Printf("Loaded and started camera: %s -> %s\n", camConfig.Name, resolveSourceType(camConfig))
 		fmt.Printf("----------------------------------------\n")
-		fmt.Printf("Name: %s\nDevice: %d\nFramerate: %d\nFrame Width: %d\nFrame Height: %d\nActual Resolution: %.2f x %.2f\n",
-			camConfig.Name, camConfig.Device, camConfig.FrameRate, camConfig.FrameWidth, camConfig.FrameHeight, actualWidth, actualHeight)
+		fmt.Printf("Name: %s\nSource: %s\nDevice: %d\nFramerate: %d\nFrame Width: %d\nFrame Height: %d\nActual Resolution: %.2f x %.2f\n",
+			camConfig.Name, resolveSourceType(camConfig), camConfig.Device, camConfig.FrameRate, camConfig.FrameWidth, camConfig.FrameHeight, actualWidth, actualHeight)
+		fmt.Printf("----------------------------------------\n")
+		fmt.Printf("Detection: %t\n", cam.detection.Enabled)
+		fmt.Printf("Motion: %t\n", cam.motion != nil)
 		fmt.Printf("----------------------------------------\n")
 		fmt.Printf("Modes:\n")
 		for camMode, mode := range camConfig.Modes {
-			fmt.Printf(" \nMode: %s\n  Brightness: %.2f\n  Contrast: %.2f\n  Rotate: %d\n  Flip: %d\n  Saturation: %.2f\n  Quality: %d\n  Output Frame Width: %d\n  Output Frame Height: %d\n",
-				camMode, mode.Brightness, mode.Contrast, mode.Rotate, mode.Flip, mode.Saturation, mode.Quality, mode.OutFrameWidth, mode.OutFrameHeight)
+			fmt.Printf(" \nMode: %s\n  Brightness: %.2f\n  Contrast: %.2f\n  Rotate: %d\n  Flip: %d\n  Saturation: %.2f\n  Quality: %d\n  Output Frame Width: %d\n  Output Frame Height: %d\n  Overlay: %t\n",
+				camMode, mode.Brightness, mode.Contrast, mode.Rotate, mode.Flip, mode.Saturation, mode.Quality, mode.OutFrameWidth, mode.OutFrameHeight, mode.DrawOverlay())
 		}
 		fmt.Printf("========================================\n")
 	}
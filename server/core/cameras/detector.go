@@ -0,0 +1,108 @@
+// core/cameras/detector.go
+package cameras
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"smuggr.xyz/gatecam/common/config"
+
+	"gocv.io/x/gocv"
+)
+
+// Labels of the MobileNet-SSD model trained on PASCAL VOC, capitalized like
+// the "Car" and "Person" detections reported before other models existed
+var vocLabels = []string{
+	"Background", "Aeroplane", "Bicycle", "Bird", "Boat", "Bottle", "Bus", "Car", "Cat", "Chair",
+	"Cow", "Diningtable", "Dog", "Horse", "Motorbike", "Person", "Pottedplant", "Sheep", "Sofa", "Train", "Tvmonitor",
+}
+
+type Detector interface {
+	Detect(frame gocv.Mat) ([]Entity, error)
+	Close() error
+}
+
+type noopDetector struct{}
+
+func (nd noopDetector) Detect(frame gocv.Mat) ([]Entity, error) {
+	return nil, nil
+}
+
+func (nd noopDetector) Close() error {
+	return nil
+}
+
+// Keeps cameras configured before detection backends existed on the MobileNet-SSD
+// model referenced by the environment.
+func withDetectionDefaults(detConfig config.DetectionConfig) config.DetectionConfig {
+	if detConfig.Model == "" {
+		detConfig.Model = config.ModelCaffe
+		detConfig.ConfigPath = os.Getenv("MOBILENET_PROTOTXT")
+		detConfig.ModelPath = os.Getenv("MOBILENET_MODEL")
+		if detConfig.Scale == 0 {
+			detConfig.Scale = 1.0 / 127.5
+		}
+		if detConfig.Mean == nil {
+			detConfig.Mean = []float64{127.5, 127.5, 127.5}
+		}
+		if detConfig.LabelsPath == "" && detConfig.Classes == nil {
+			detConfig.Classes = []string{"Car", "Person"}
+		}
+	}
+
+	if detConfig.Output == "" {
+		if detConfig.Model == config.ModelCaffe {
+			detConfig.Output = config.OutputSSD
+		} else {
+			detConfig.Output = config.OutputYOLO
+		}
+	}
+	if detConfig.InputWidth <= 0 {
+		detConfig.InputWidth = 300
+	}
+	if detConfig.InputHeight <= 0 {
+		detConfig.InputHeight = 300
+	}
+	if detConfig.Scale == 0 {
+		detConfig.Scale = 1.0
+	}
+	if detConfig.Confidence <= 0 {
+		detConfig.Confidence = 0.5
+	}
+
+	return detConfig
+}
+
+func NewDetector(detConfig config.DetectionConfig) (Detector, error) {
+	detConfig = withDetectionDefaults(detConfig)
+
+	switch detConfig.Model {
+	case config.ModelNone:
+		return noopDetector{}, nil
+	case config.ModelCaffe, config.ModelONNX, config.ModelDarknet:
+		return newDNNDetector(detConfig)
+	default:
+		return nil, fmt.Errorf("unsupported detection model: %s", detConfig.Model)
+	}
+}
+
+func loadLabels(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening labels file: %v", err)
+	}
+	defer file.Close()
+
+	labels := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		labels = append(labels, strings.TrimSpace(scanner.Text()))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading labels file: %v", err)
+	}
+
+	return labels, nil
+}
@@ -0,0 +1,234 @@
+// core/cameras/detector_dnn.go
+package cameras
+
+import (
+	"fmt"
+	"image"
+	"strings"
+	"time"
+
+	"smuggr.xyz/gatecam/common/config"
+
+	"gocv.io/x/gocv"
+)
+
+type dnnDetector struct {
+	net        gocv.Net
+	output     config.ModelOutput
+	outLayers  []string
+	inputSize  image.Point
+	mean       gocv.Scalar
+	scale      float64
+	swapRB     bool
+	labels     []string
+	classes    map[string]bool
+	confidence float32
+}
+
+func newDNNDetector(detConfig config.DetectionConfig) (Detector, error) {
+	if detConfig.ModelPath == "" {
+		return nil, fmt.Errorf("no model path configured for %s model", detConfig.Model)
+	}
+
+	modelConfigPath := detConfig.ConfigPath
+	if detConfig.Model == config.ModelONNX {
+		modelConfigPath = ""
+	}
+
+	net := gocv.ReadNet(detConfig.ModelPath, modelConfigPath)
+	if net.Empty() {
+		return nil, fmt.Errorf("error loading %s model %s", detConfig.Model, detConfig.ModelPath)
+	}
+
+	// Inference is CPU-only, no accelerator is assumed to be present
+	if err := net.SetPreferableBackend(gocv.NetBackendDefault); err != nil {
+		net.Close()
+		return nil, fmt.Errorf("error setting DNN backend: %v", err)
+	}
+	if err := net.SetPreferableTarget(gocv.NetTargetCPU); err != nil {
+		net.Close()
+		return nil, fmt.Errorf("error setting DNN target: %v", err)
+	}
+
+	labels := vocLabels
+	if detConfig.LabelsPath != "" {
+		var err error
+		if labels, err = loadLabels(detConfig.LabelsPath); err != nil {
+			net.Close()
+			return nil, err
+		}
+	}
+
+	var classes map[string]bool
+	if len(detConfig.Classes) > 0 {
+		classes = make(map[string]bool)
+		for _, class := range detConfig.Classes {
+			classes[strings.ToLower(class)] = true
+		}
+	}
+
+	mean := gocv.NewScalar(0, 0, 0, 0)
+	if len(detConfig.Mean) == 3 {
+		mean = gocv.NewScalar(detConfig.Mean[0], detConfig.Mean[1], detConfig.Mean[2], 0)
+	} else if len(detConfig.Mean) == 1 {
+		mean = gocv.NewScalar(detConfig.Mean[0], detConfig.Mean[0], detConfig.Mean[0], 0)
+	}
+
+	var outLayers []string
+	if detConfig.Output == config.OutputYOLO {
+		layerNames := net.GetLayerNames()
+		for _, id := range net.GetUnconnectedOutLayers() {
+			outLayers = append(outLayers, layerNames[id-1])
+		}
+	}
+
+	return &dnnDetector{
+		net:        net,
+		output:     detConfig.Output,
+		outLayers:  outLayers,
+		inputSize:  image.Pt(detConfig.InputWidth, detConfig.InputHeight),
+		mean:       mean,
+		scale:      detConfig.Scale,
+		swapRB:     detConfig.SwapRB,
+		labels:     labels,
+		classes:    classes,
+		confidence: detConfig.Confidence,
+	}, nil
+}
+
+func (dd *dnnDetector) label(classID int) string {
+	if classID >= 0 && classID < len(dd.labels) {
+		return dd.labels[classID]
+	}
+	return fmt.Sprintf("class_%d", classID)
+}
+
+func (dd *dnnDetector) accepts(label string) bool {
+	return dd.classes == nil || dd.classes[strings.ToLower(label)]
+}
+
+func (dd *dnnDetector) Detect(frame gocv.Mat) ([]Entity, error) {
+	blob := gocv.BlobFromImage(frame, dd.scale, dd.inputSize, dd.mean, dd.swapRB, false)
+	defer blob.Close()
+
+	dd.net.SetInput(blob, "")
+
+	switch dd.output {
+	case config.OutputSSD:
+		output := dd.net.Forward("")
+		defer output.Close()
+		return dd.parseSSD(output, frame.Cols(), frame.Rows())
+	case config.OutputYOLO:
+		outputs := dd.net.ForwardLayers(dd.outLayers)
+		defer func() {
+			for _, output := range outputs {
+				output.Close()
+			}
+		}()
+
+		detections := []Entity{}
+		for _, output := range outputs {
+			entities, err := dd.parseYOLO(output, frame.Cols(), frame.Rows())
+			if err != nil {
+				return nil, err
+			}
+			detections = append(detections, entities...)
+		}
+		return detections, nil
+	default:
+		return nil, fmt.Errorf("unsupported model output: %s", dd.output)
+	}
+}
+
+func (dd *dnnDetector) parseSSD(output gocv.Mat, width, height int) ([]Entity, error) {
+	data, err := output.DataPtrFloat32()
+	if err != nil {
+		return nil, fmt.Errorf("unexpected SSD output: %v", err)
+	}
+
+	detections := []Entity{}
+	for i := 0; i+7 <= len(data); i += 7 {
+		confidence := data[i+2]
+		if confidence < dd.confidence {
+			continue
+		}
+
+		label := dd.label(int(data[i+1]))
+		if !dd.accepts(label) {
+			continue
+		}
+
+		x1 := int(data[i+3] * float32(width))
+		y1 := int(data[i+4] * float32(height))
+		x2 := int(data[i+5] * float32(width))
+		y2 := int(data[i+6] * float32(height))
+		detections = append(detections, Entity{
+			Rect:       image.Rect(x1, y1, x2, y2).Intersect(image.Rect(0, 0, width, height)),
+			Confidence: confidence,
+			Label:      label,
+			Timestamp:  time.Now(),
+		})
+	}
+
+	return detections, nil
+}
+
+// Handles darknet and YOLOv3-v5 style ONNX outputs, with the box either
+// normalized or in input pixels.
+func (dd *dnnDetector) parseYOLO(output gocv.Mat, width, height int) ([]Entity, error) {
+	data, err := output.DataPtrFloat32()
+	if err != nil {
+		return nil, fmt.Errorf("unexpected YOLO output: %v", err)
+	}
+
+	dims := output.Size()
+	stride := dims[len(dims)-1]
+	if stride <= 5 {
+		return nil, fmt.Errorf("unexpected YOLO output shape: %v", dims)
+	}
+
+	detections := []Entity{}
+	for i := 0; i+stride <= len(data); i += stride {
+		row := data[i : i+stride]
+
+		classID, classScore := 0, float32(0)
+		for id, score := range row[5:] {
+			if score > classScore {
+				classID, classScore = id, score
+			}
+		}
+
+		confidence := row[4] * classScore
+		if confidence < dd.confidence {
+			continue
+		}
+
+		label := dd.label(classID)
+		if !dd.accepts(label) {
+			continue
+		}
+
+		cx, cy, w, h := row[0], row[1], row[2], row[3]
+		if cx > 1.5 || cy > 1.5 || w > 1.5 || h > 1.5 {
+			cx, w = cx/float32(dd.inputSize.X), w/float32(dd.inputSize.X)
+			cy, h = cy/float32(dd.inputSize.Y), h/float32(dd.inputSize.Y)
+		}
+
+		x1 := int((cx - w/2) * float32(width))
+		y1 := int((cy - h/2) * float32(height))
+		x2 := int((cx + w/2) * float32(width))
+		y2 := int((cy + h/2) * float32(height))
+		detections = append(detections, Entity{
+			Rect:       image.Rect(x1, y1, x2, y2).Intersect(image.Rect(0, 0, width, height)),
+			Confidence: confidence,
+			Label:      label,
+			Timestamp:  time.Now(),
+		})
+	}
+
+	return detections, nil
+}
+
+func (dd *dnnDetector) Close() error {
+	return dd.net.Close()
+}
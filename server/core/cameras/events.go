@@ -0,0 +1,62 @@
+// core/cameras/events.go
+package cameras
+
+import "time"
+
+const eventQueueSize = 64
+
+type EventType string
+
+const (
+	EventEntityAppeared    EventType = "entity_appeared"
+	EventEntityDisappeared EventType = "entity_disappeared"
+	EventZoneEntered       EventType = "zone_entered"
+	EventZoneExited        EventType = "zone_exited"
+	EventLineCrossed       EventType = "line_crossed"
+	EventMotionStarted     EventType = "motion_started"
+	EventMotionEnded       EventType = "motion_ended"
+)
+
+type Event struct {
+	Type      EventType         `json:"type"`
+	Camera    string            `json:"camera"`
+	Entity    *Entity           `json:"entity,omitempty"`
+	Zone      string            `json:"zone,omitempty"`
+	Line      string            `json:"line,omitempty"`
+	Direction CrossingDirection `json:"direction,omitempty"`
+	Motion    *MotionState      `json:"motion,omitempty"`
+	Snapshot  *Snapshot         `json:"-"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+func (cam *Camera) publishEvent(event Event) {
+	event.Camera = cam.Name
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	cam.events.Publish(event)
+}
+
+func (cam *Camera) publishTrackEvents(appeared, disappeared []Entity, snapshot *Snapshot, now time.Time) {
+	for i := range appeared {
+		event := Event{Type: EventEntityAppeared, Entity: &appeared[i], Timestamp: now}
+		if cam.snapshotsLabel(appeared[i].Label) {
+			event.Snapshot = snapshot
+		}
+		cam.publishEvent(event)
+	}
+	for i := range disappeared {
+		cam.publishEvent(Event{Type: EventEntityDisappeared, Entity: &disappeared[i], Timestamp: now})
+	}
+}
+
+func (cam *Camera) publishEvents(events []Event) {
+	for _, event := range events {
+		cam.publishEvent(event)
+	}
+}
+
+func (cam *Camera) SubscribeEvents() *Subscriber[Event] {
+	return cam.events.Subscribe()
+}
@@ -0,0 +1,55 @@
+// core/cameras/frame.go
+package cameras
+
+import (
+	"sync/atomic"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+// A captured frame shared by every consumer of a camera. The Mat must be
+// treated as read-only, consumers that modify it have to work on a clone.
+type Frame struct {
+	Mat        gocv.Mat
+	Seq        uint64
+	Timestamp  time.Time
+	Detections []Entity
+	refs       atomic.Int32
+}
+
+func newFrame(mat gocv.Mat, seq uint64, detections []Entity) *Frame {
+	frame := &Frame{
+		Mat:        mat,
+		Seq:        seq,
+		Timestamp:  time.Now(),
+		Detections: detections,
+	}
+	frame.refs.Store(1)
+	return frame
+}
+
+func (f *Frame) Retain() *Frame {
+	f.acquire()
+	return f
+}
+
+func (f *Frame) acquire() {
+	f.refs.Add(1)
+}
+
+func (f *Frame) Release() {
+	if f.refs.Add(-1) == 0 {
+		f.Mat.Close()
+	}
+}
+
+// An encoded output of a camera mode, shared as-is between all its clients.
+type EncodedFrame struct {
+	Data       []byte
+	Seq        uint64
+	Timestamp  time.Time
+	Width      int
+	Height     int
+	Detections []Entity
+}
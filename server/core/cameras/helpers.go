@@ -7,7 +7,6 @@ import (
 	"image"
 	"image/color"
 	"image/jpeg"
-	"time"
 
 	"gocv.io/x/gocv"
 	"smuggr.xyz/gatecam/common/config"
@@ -40,43 +39,11 @@ func matToRGB565(mat *gocv.Mat) ([]byte, error) {
 	return rgb565, nil
 }
 
-func (cam *Camera) detectObjects(frame gocv.Mat) []Entity {
-	detections := []Entity{}
-
-	blob := gocv.BlobFromImage(frame, 1.0/127.5, image.Pt(300, 300), gocv.NewScalar(127.5, 127.5, 127.5, 0), false, false)
-	defer blob.Close()
-
-	cam.net.SetInput(blob, "")
-	output := cam.net.Forward("")
-
-	nrows := output.Total() / 7
-	for i := 0; i < nrows; i++ {
-		confidence := output.GetFloatAt(0, i*7+2)
-		if confidence > 0.5 {
-			classID := int(output.GetFloatAt(0, i*7+1))
-			if classID == 7 || classID == 15 {
-				x1 := int(output.GetFloatAt(0, i*7+3) * float32(frame.Cols()))
-				y1 := int(output.GetFloatAt(0, i*7+4) * float32(frame.Rows()))
-				x2 := int(output.GetFloatAt(0, i*7+5) * float32(frame.Cols()))
-				y2 := int(output.GetFloatAt(0, i*7+6) * float32(frame.Rows()))
-				detections = append(detections, Entity{
-					Rect:       image.Rect(x1, y1, x2, y2),
-					Confidence: confidence,
-					Label:      map[int]string{7: "Car", 15: "Person"}[classID],
-					Timestamp:  time.Now(),
-				})
-			}
-		}
-	}
-
-	return detections
-}
-
 func (cam *Camera) drawDetections(frame *gocv.Mat, detections []Entity) {
 	for _, det := range detections {
 		gocv.Rectangle(frame, det.Rect, color.RGBA{0, 255, 0, 0}, 2)
 
-		label := fmt.Sprintf(det.Label+" %f", det.Confidence)
+		label := fmt.Sprintf("#%d %s %.2f", det.TrackID, det.Label, det.Confidence)
 		gocv.PutText(frame, label, image.Pt(det.Rect.Min.X, det.Rect.Min.Y-10),
 			gocv.FontHersheySimplex, 1.0, color.RGBA{0, 255, 0, 0}, 2)
 	}
@@ -121,6 +88,42 @@ func (cam *Camera) scaleImage(mat *gocv.Mat, modeConfig config.CameraModeConfig)
 	*mat = resized
 }
 
+// Maps a point from source frame coordinates into the coordinates of a frame
+// that went through applyPostProcessing with the same mode config.
+func mapPoint(p image.Point, width, height int, modeConfig config.CameraModeConfig) image.Point {
+	switch modeConfig.Rotate {
+	case 90:
+		p = image.Pt(height-p.Y, p.X)
+		width, height = height, width
+	case 180:
+		p = image.Pt(width-p.X, height-p.Y)
+	case 270:
+		p = image.Pt(p.Y, width-p.X)
+		width, height = height, width
+	}
+
+	switch modeConfig.Flip {
+	case -1:
+		p = image.Pt(width-p.X, height-p.Y)
+	case 0:
+		p = image.Pt(p.X, height-p.Y)
+	case 1:
+		p = image.Pt(width-p.X, p.Y)
+	}
+
+	if modeConfig.OutFrameWidth > 0 && modeConfig.OutFrameHeight > 0 && width > 0 && height > 0 {
+		p = image.Pt(p.X*modeConfig.OutFrameWidth/width, p.Y*modeConfig.OutFrameHeight/height)
+	}
+
+	return p
+}
+
+func mapRect(rect image.Rectangle, width, height int, modeConfig config.CameraModeConfig) image.Rectangle {
+	min := mapPoint(rect.Min, width, height, modeConfig)
+	max := mapPoint(rect.Max, width, height, modeConfig)
+	return image.Rectangle{Min: min, Max: max}.Canon()
+}
+
 func (cam *Camera) applyPostProcessing(mat *gocv.Mat, modeConfig config.CameraModeConfig) {
 	cam.rotateImage(mat, modeConfig)
 	cam.flipImage(mat, modeConfig)
@@ -160,19 +163,3 @@ func (cam *Camera) grabFrameJPEG(mat gocv.Mat, modeConfig config.CameraModeConfi
 	}
 	return buf.Bytes(), nil
 }
-
-func (cam *Camera) checkAndRecoverCamera() {
-	cam.mu.Lock()
-	defer cam.mu.Unlock()
-
-	if !cam.capture.IsOpened() {
-		fmt.Printf("camera %s disconnected, attempting to reinitialize\n", cam.Name)
-		cam.capture.Close()
-		newCap, err := gocv.OpenVideoCapture(cam.Device)
-		if err != nil {
-			fmt.Printf("failed to reinitialize camera %s: %v\n", cam.Name, err)
-			return
-		}
-		cam.capture = newCap
-	}
-}
@@ -0,0 +1,207 @@
+// core/cameras/motion.go
+package cameras
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sync"
+	"time"
+
+	"smuggr.xyz/gatecam/common/config"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	defaultMotionSensitivity = 0.5
+	defaultMotionMinArea     = 200
+	defaultMotionWidth       = 320
+	defaultMotionCooldown    = 10 * time.Second
+	motionHistory            = 500
+
+	// Thresholds of the subtractors at the default sensitivity
+	mog2VarThreshold  = 16.0
+	knnDist2Threshold = 400.0
+)
+
+type MotionState struct {
+	Active     bool              `json:"active"`
+	Score      float64           `json:"score"`   // Share of the frame in motion, 0..1
+	Regions    []image.Rectangle `json:"regions"` // In source frame coordinates
+	LastMotion time.Time         `json:"last_motion"`
+}
+
+type backgroundSubtractor interface {
+	Apply(src gocv.Mat, dst *gocv.Mat)
+	Close() error
+}
+
+type MotionDetector struct {
+	subtractor backgroundSubtractor
+	kernel     gocv.Mat
+	minArea    float64
+	width      int
+	cooldown   time.Duration
+	state      MotionState
+	mu         sync.RWMutex
+}
+
+func NewMotionDetector(motionConfig config.MotionConfig) (*MotionDetector, error) {
+	sensitivity := motionConfig.Sensitivity
+	if sensitivity <= 0 {
+		sensitivity = defaultMotionSensitivity
+	}
+	if sensitivity > 1 {
+		return nil, fmt.Errorf("invalid motion sensitivity: %.2f", sensitivity)
+	}
+
+	// Every 0.25 of sensitivity halves or doubles the subtractor threshold
+	thresholdScale := math.Pow(2, (defaultMotionSensitivity-sensitivity)*4)
+
+	var subtractor backgroundSubtractor
+	switch motionConfig.Algorithm {
+	case "", config.MotionMOG2:
+		mog2 := gocv.NewBackgroundSubtractorMOG2WithParams(motionHistory, mog2VarThreshold*thresholdScale, true)
+		subtractor = &mog2
+	case config.MotionKNN:
+		knn := gocv.NewBackgroundSubtractorKNNWithParams(motionHistory, knnDist2Threshold*thresholdScale, true)
+		subtractor = &knn
+	default:
+		return nil, fmt.Errorf("unsupported motion algorithm: %s", motionConfig.Algorithm)
+	}
+
+	md := &MotionDetector{
+		subtractor: subtractor,
+		kernel:     gocv.GetStructuringElement(gocv.MorphRect, image.Pt(3, 3)),
+		minArea:    float64(motionConfig.MinArea),
+		width:      motionConfig.Width,
+		cooldown:   motionConfig.Cooldown,
+	}
+
+	if md.minArea <= 0 {
+		md.minArea = defaultMotionMinArea
+	}
+	if md.width <= 0 {
+		md.width = defaultMotionWidth
+	}
+	if md.cooldown <= 0 {
+		md.cooldown = defaultMotionCooldown
+	}
+
+	return md, nil
+}
+
+// Analyses one frame and returns the new state together with whether motion
+// started or ended with it.
+func (md *MotionDetector) Process(frame gocv.Mat, now time.Time) (MotionState, bool) {
+	width, height := frame.Cols(), frame.Rows()
+	if width == 0 || height == 0 {
+		return md.State(), false
+	}
+
+	scaledWidth := md.width
+	if scaledWidth > width {
+		scaledWidth = width
+	}
+	scaledHeight := height * scaledWidth / width
+	scale := float64(width) / float64(scaledWidth)
+
+	small := gocv.NewMat()
+	defer small.Close()
+	gocv.Resize(frame, &small, image.Pt(scaledWidth, scaledHeight), 0, 0, gocv.InterpolationArea)
+	gocv.GaussianBlur(small, &small, image.Pt(5, 5), 0, 0, gocv.BorderDefault)
+
+	mask := gocv.NewMat()
+	defer mask.Close()
+	md.subtractor.Apply(small, &mask)
+
+	// Shadows are marked gray by the subtractors, only keep real foreground
+	gocv.Threshold(mask, &mask, 200, 255, gocv.ThresholdBinary)
+	gocv.MorphologyEx(mask, &mask, gocv.MorphOpen, md.kernel)
+
+	contours := gocv.FindContours(mask, gocv.RetrievalExternal, gocv.ChainApproxSimple)
+	defer contours.Close()
+
+	regions := []image.Rectangle{}
+	for i := 0; i < contours.Size(); i++ {
+		contour := contours.At(i)
+		if gocv.ContourArea(contour) < md.minArea {
+			continue
+		}
+
+		rect := gocv.BoundingRect(contour)
+		regions = append(regions, image.Rect(
+			int(float64(rect.Min.X)*scale), int(float64(rect.Min.Y)*scale),
+			int(float64(rect.Max.X)*scale), int(float64(rect.Max.Y)*scale),
+		))
+	}
+
+	md.mu.Lock()
+	defer md.mu.Unlock()
+
+	wasActive := md.state.Active
+	md.state.Score = float64(gocv.CountNonZero(mask)) / float64(mask.Total())
+	md.state.Regions = regions
+	if len(regions) > 0 {
+		md.state.LastMotion = now
+	}
+	md.state.Active = !md.state.LastMotion.IsZero() && now.Sub(md.state.LastMotion) <= md.cooldown
+
+	return md.state, md.state.Active != wasActive
+}
+
+func (md *MotionDetector) State() MotionState {
+	md.mu.RLock()
+	defer md.mu.RUnlock()
+
+	state := md.state
+	state.Regions = append([]image.Rectangle{}, md.state.Regions...)
+	return state
+}
+
+// Whether motion was seen recently enough for detection to keep running.
+func (md *MotionDetector) Active() bool {
+	md.mu.RLock()
+	defer md.mu.RUnlock()
+
+	return md.state.Active
+}
+
+func (md *MotionDetector) Close() error {
+	md.kernel.Close()
+	return md.subtractor.Close()
+}
+
+func (cam *Camera) detectMotion(sub *Subscriber[*Frame]) {
+	defer cam.wg.Done()
+	defer sub.Close()
+
+	for {
+		frame, ok := sub.Next(cam.stop)
+		if !ok {
+			return
+		}
+
+		now := frame.Timestamp
+		state, changed := cam.motion.Process(frame.Mat, now)
+		frame.Release()
+		if !changed {
+			continue
+		}
+
+		eventType := EventMotionEnded
+		if state.Active {
+			eventType = EventMotionStarted
+		}
+		cam.publishEvent(Event{Type: eventType, Motion: &state, Timestamp: now})
+	}
+}
+
+func (cam *Camera) Motion() (MotionState, bool) {
+	if cam.motion == nil {
+		return MotionState{}, false
+	}
+
+	return cam.motion.State(), true
+}
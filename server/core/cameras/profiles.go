@@ -0,0 +1,310 @@
+// core/cameras/profiles.go
+package cameras
+
+import (
+	"fmt"
+	"time"
+
+	"smuggr.xyz/gatecam/common/config"
+)
+
+const (
+	defaultMinStreamWidth   = 160
+	defaultMinStreamQuality = 10
+	defaultMaxProfiles      = 4
+	maxStreamWidth          = 4096
+	maxStreamFrameRate      = 120
+	defaultStreamFrameRate  = 15 // Assumed by the quality adapter when the camera has no frame_rate
+	adaptiveQualityStep     = 10 // Adapted qualities snap to this grid so slow clients share encoders
+	adaptiveRecoverTime     = 2 * time.Second
+	adaptiveHoldTime        = time.Second // Frames queued before a change are still slow to write
+)
+
+// What a client of the jpeg_stream mode asked for. Zero fields keep the
+// setting of the shared output.
+type StreamProfile struct {
+	Width   int `json:"width"`
+	Quality int `json:"quality"`
+	FPS     int `json:"fps"`
+}
+
+func (p StreamProfile) String() string {
+	return fmt.Sprintf("%dw-q%d-%dfps", p.Width, p.Quality, p.FPS)
+}
+
+type profileEncoder struct {
+	profile     StreamProfile
+	broadcaster *Broadcaster[*EncodedFrame]
+}
+
+func clampInt(v, lo, hi int) int {
+	return max(lo, min(v, hi))
+}
+
+// The profile of the shared jpeg_stream output. A width of 0 means the frames
+// are not scaled, an fps of 0 that every captured frame is encoded.
+func (cam *Camera) defaultProfile() StreamProfile {
+	cam.mu.Lock()
+	modeConfig := cam.outputs[config.ModeJPEGStream].config
+	cam.mu.Unlock()
+
+	return StreamProfile{
+		Width:   modeConfig.OutFrameWidth,
+		Quality: modeConfig.Quality,
+		FPS:     cam.config.FrameRate,
+	}
+}
+
+func (cam *Camera) streamLimits() (StreamProfile, StreamProfile) {
+	limits := cam.config.Stream
+	def := cam.defaultProfile()
+
+	lo := StreamProfile{Width: limits.MinWidth, Quality: limits.MinQuality, FPS: 1}
+	hi := StreamProfile{Width: limits.MaxWidth, Quality: limits.MaxQuality, FPS: limits.MaxFrameRate}
+	if lo.Width <= 0 {
+		lo.Width = defaultMinStreamWidth
+	}
+	if lo.Quality <= 0 {
+		lo.Quality = defaultMinStreamQuality
+	}
+	if hi.Width <= 0 {
+		hi.Width = def.Width
+	}
+	if hi.Width <= 0 {
+		hi.Width = maxStreamWidth
+	}
+	if hi.Quality <= 0 {
+		hi.Quality = def.Quality
+	}
+	if hi.FPS <= 0 {
+		hi.FPS = def.FPS
+	}
+	if hi.FPS <= 0 {
+		hi.FPS = maxStreamFrameRate
+	}
+
+	return lo, hi
+}
+
+// Fills the unset fields of a requested profile and clamps it into the limits
+// of the camera.
+func (cam *Camera) ResolveProfile(req StreamProfile) StreamProfile {
+	def := cam.defaultProfile()
+	lo, hi := cam.streamLimits()
+
+	if req.Width <= 0 {
+		req.Width = def.Width
+	}
+	if req.Quality <= 0 {
+		req.Quality = def.Quality
+	}
+	if req.FPS <= 0 {
+		req.FPS = def.FPS
+	}
+
+	if req.Width > 0 {
+		req.Width = clampInt(req.Width, lo.Width, max(lo.Width, hi.Width))
+	}
+	if req.FPS > 0 {
+		req.FPS = clampInt(req.FPS, lo.FPS, max(lo.FPS, hi.FPS))
+	}
+
+	return StreamProfile{
+		Width:   req.Width,
+		Quality: clampInt(req.Quality, lo.Quality, max(lo.Quality, hi.Quality)),
+		FPS:     req.FPS,
+	}
+}
+
+// Subscribes to the jpeg_stream mode at a profile. Clients asking for the
+// same profile share one encoder, which stops with its last subscriber. The
+// shared output is used for the default profile and once the camera runs
+// its maximum number of profiles.
+func (cam *Camera) SubscribeProfile(req StreamProfile) (*Subscriber[*EncodedFrame], StreamProfile, error) {
+	def := cam.defaultProfile()
+	profile := cam.ResolveProfile(req)
+	if req == (StreamProfile{}) || profile == def {
+		sub, err := cam.Subscribe(config.ModeJPEGStream)
+		return sub, def, err
+	}
+
+	cam.mu.Lock()
+	defer cam.mu.Unlock()
+
+	output, ok := cam.outputs[config.ModeJPEGStream]
+	if !ok {
+		return nil, profile, fmt.Errorf("camera %s has no %s mode", cam.Name, config.ModeJPEGStream)
+	}
+
+	if enc, ok := cam.profiles[profile]; ok {
+		return enc.broadcaster.Subscribe(), profile, nil
+	}
+
+	maxProfiles := cam.config.Stream.MaxProfiles
+	if maxProfiles <= 0 {
+		maxProfiles = defaultMaxProfiles
+	}
+	if !cam.running || len(cam.profiles) >= maxProfiles {
+		return output.broadcaster.Subscribe(), def, nil
+	}
+
+	enc := &profileEncoder{
+		profile:     profile,
+		broadcaster: NewBroadcaster[*EncodedFrame](cam.idleTimeout()),
+	}
+	cam.profiles[profile] = enc
+	sub := enc.broadcaster.Subscribe()
+
+	cam.wg.Add(1)
+	go cam.encodeProfile(enc, cam.frames.Subscribe())
+
+	return sub, profile, nil
+}
+
+func (cam *Camera) idleTimeout() time.Duration {
+	if cam.config.IdleTimeout > 0 {
+		return cam.config.IdleTimeout
+	}
+	return defaultIdleTimeout
+}
+
+// Checked before every encode, an encoder without subscribers is removed
+// while holding the lock so no new subscriber can pick it up.
+func (cam *Camera) profileWanted(enc *profileEncoder) bool {
+	cam.mu.Lock()
+	defer cam.mu.Unlock()
+
+	if enc.broadcaster.SubscriberCount() > 0 {
+		return true
+	}
+
+	if cam.profiles[enc.profile] == enc {
+		delete(cam.profiles, enc.profile)
+	}
+	return false
+}
+
+func (cam *Camera) encodeProfile(enc *profileEncoder, sub *Subscriber[*Frame]) {
+	defer cam.wg.Done()
+	defer sub.Close()
+	defer enc.broadcaster.Close()
+
+	// Frames arrive with jitter, a quarter of the interval of tolerance keeps
+	// e.g. 15 out of 30 fps from dropping to 10
+	var minGap time.Duration
+	if enc.profile.FPS > 0 {
+		interval := time.Second / time.Duration(enc.profile.FPS)
+		minGap = interval - interval/4
+	}
+
+	var last time.Time
+	for {
+		frame, ok := sub.Next(cam.stop)
+		if !ok {
+			break
+		}
+
+		if !cam.profileWanted(enc) {
+			frame.Release()
+			return
+		}
+
+		if frame.Timestamp.Sub(last) < minGap {
+			frame.Release()
+			continue
+		}
+		last = frame.Timestamp
+
+		encoded, err := cam.EncodeJPEG(frame, JPEGOptions{Width: enc.profile.Width, Quality: enc.profile.Quality})
+		frame.Release()
+		if err != nil {
+			fmt.Printf("error encoding profile %s of camera %s: %v\n", enc.profile, cam.Name, err)
+			continue
+		}
+
+		enc.broadcaster.Publish(encoded)
+	}
+
+	cam.mu.Lock()
+	if cam.profiles[enc.profile] == enc {
+		delete(cam.profiles, enc.profile)
+	}
+	cam.mu.Unlock()
+}
+
+// Lowers the quality of a client whose writes take up a growing share of the
+// frame interval, and raises it back towards the requested one once the
+// client keeps up again.
+type QualityAdapter struct {
+	requested StreamProfile
+	current   StreamProfile
+	minimum   int
+	changedAt time.Time
+	fastSince time.Time
+}
+
+// Returns nil when the camera does not adapt stream quality.
+func (cam *Camera) NewQualityAdapter(profile StreamProfile) *QualityAdapter {
+	if !cam.config.Stream.Adaptive {
+		return nil
+	}
+
+	lo, _ := cam.streamLimits()
+	return &QualityAdapter{
+		requested: profile,
+		current:   profile,
+		minimum:   lo.Quality,
+	}
+}
+
+// Continues from the profile the client is actually subscribed to, e.g. when
+// a switch failed.
+func (a *QualityAdapter) Reset(profile StreamProfile) {
+	a.current = profile
+	a.changedAt = time.Now()
+	a.fastSince = time.Time{}
+}
+
+// Reports how long writing a frame took. Returns the profile to switch to
+// when the quality should change.
+func (a *QualityAdapter) Observe(writeTime time.Duration) (StreamProfile, bool) {
+	fps := a.current.FPS
+	if fps <= 0 {
+		fps = defaultStreamFrameRate
+	}
+	interval := time.Second / time.Duration(fps)
+	if time.Since(a.changedAt) < adaptiveHoldTime {
+		return a.current, false
+	}
+
+	switch {
+	case writeTime > interval/2:
+		a.fastSince = time.Time{}
+		if a.current.Quality <= a.minimum {
+			return a.current, false
+		}
+
+		a.current.Quality = max(a.minimum, (a.current.Quality-1)/adaptiveQualityStep*adaptiveQualityStep)
+		a.changedAt = time.Now()
+		return a.current, true
+	case writeTime < interval/10:
+		if a.current.Quality >= a.requested.Quality {
+			return a.current, false
+		}
+		if a.fastSince.IsZero() {
+			a.fastSince = time.Now()
+			return a.current, false
+		}
+		if time.Since(a.fastSince) < adaptiveRecoverTime {
+			return a.current, false
+		}
+
+		a.fastSince = time.Time{}
+		a.current.Quality = min(a.requested.Quality, (a.current.Quality/adaptiveQualityStep+1)*adaptiveQualityStep)
+		a.changedAt = time.Now()
+		return a.current, true
+	default:
+		a.fastSince = time.Time{}
+		return a.current, false
+	}
+}
@@ -0,0 +1,92 @@
+// core/cameras/ring.go
+package cameras
+
+import (
+	"sync"
+	"time"
+
+	"smuggr.xyz/gatecam/common/config"
+)
+
+const (
+	defaultRecordingFrameRate = 15
+	defaultClipPreRoll        = 5 * time.Second
+)
+
+// Recordings and the pre-roll sample frames at this rate.
+func RecordingFrameRate(camConfig config.CameraConfig) int {
+	if camConfig.Recording.FrameRate > 0 {
+		return camConfig.Recording.FrameRate
+	}
+	if camConfig.FrameRate > 0 {
+		return camConfig.FrameRate
+	}
+	return defaultRecordingFrameRate
+}
+
+func ClipPreRoll(clipConfig config.ClipConfig) time.Duration {
+	if clipConfig.PreRoll > 0 {
+		return clipConfig.PreRoll
+	}
+	return defaultClipPreRoll
+}
+
+// Keeps the most recent window of frames sampled at a fixed rate, used as
+// pre-roll for clips. Frames are retained while buffered, so the ring holds
+// window * frame rate raw BGR frames, 900KB each at 640x480.
+type FrameRing struct {
+	frames   []*Frame
+	window   time.Duration
+	interval time.Duration
+	mu       sync.Mutex
+}
+
+func NewFrameRing(window time.Duration, frameRate int) *FrameRing {
+	if frameRate <= 0 {
+		frameRate = 1
+	}
+
+	return &FrameRing{
+		window:   window,
+		interval: time.Second / time.Duration(frameRate),
+	}
+}
+
+func (r *FrameRing) Push(frame *Frame) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if n := len(r.frames); n > 0 && frame.Timestamp.Sub(r.frames[n-1].Timestamp) < r.interval {
+		return
+	}
+	r.frames = append(r.frames, frame.Retain())
+
+	expired := 0
+	for expired < len(r.frames) && frame.Timestamp.Sub(r.frames[expired].Timestamp) > r.window {
+		r.frames[expired].Release()
+		expired++
+	}
+	r.frames = append(r.frames[:0], r.frames[expired:]...)
+}
+
+// Returns the buffered frames oldest first, every frame must be released.
+func (r *FrameRing) Frames() []*Frame {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	frames := make([]*Frame, len(r.frames))
+	for i, frame := range r.frames {
+		frames[i] = frame.Retain()
+	}
+	return frames
+}
+
+func (r *FrameRing) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, frame := range r.frames {
+		frame.Release()
+	}
+	r.frames = nil
+}
@@ -45,4 +45,15 @@ func (mcs *MultiCamServer) CloseAll() {
     for _, cam := range mcs.cameras {
         cam.Stop()
     }
-}
\ No newline at end of file
+}
+
+func (mcs *MultiCamServer) Cameras() []*Camera {
+    mcs.mu.RLock()
+    defer mcs.mu.RUnlock()
+
+    cameras := make([]*Camera, 0, len(mcs.cameras))
+    for _, cam := range mcs.cameras {
+        cameras = append(cameras, cam)
+    }
+    return cameras
+}
@@ -0,0 +1,81 @@
+// core/cameras/snapshot.go
+package cameras
+
+import (
+	"image"
+	"slices"
+	"time"
+
+	"smuggr.xyz/gatecam/common/config"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	defaultSnapshotQuality = 90
+	defaultThumbnailWidth  = 320
+)
+
+var defaultSnapshotLabels = []string{"Car", "Person"}
+
+// Annotated full resolution JPEG of the frame an entity first appeared in.
+type Snapshot struct {
+	Image     []byte
+	Thumbnail []byte
+	Timestamp time.Time
+}
+
+func (cam *Camera) snapshotsLabel(label string) bool {
+	snapConfig := Config.Media.Snapshots
+	if !snapConfig.Enabled {
+		return false
+	}
+
+	labels := snapConfig.Labels
+	if len(labels) == 0 {
+		labels = defaultSnapshotLabels
+	}
+	return slices.Contains(labels, label)
+}
+
+func (cam *Camera) wantsSnapshot(appeared []Entity) bool {
+	for _, entity := range appeared {
+		if cam.snapshotsLabel(entity.Label) {
+			return true
+		}
+	}
+	return false
+}
+
+func (cam *Camera) takeSnapshot(frame gocv.Mat, detections []Entity, now time.Time) (*Snapshot, error) {
+	snapConfig := Config.Media.Snapshots
+	encodeConfig := config.CameraModeConfig{Quality: snapConfig.Quality}
+	if encodeConfig.Quality <= 0 {
+		encodeConfig.Quality = defaultSnapshotQuality
+	}
+	thumbnailWidth := snapConfig.ThumbnailWidth
+	if thumbnailWidth <= 0 {
+		thumbnailWidth = defaultThumbnailWidth
+	}
+
+	mat := frame.Clone()
+	defer mat.Close()
+	cam.drawDetections(&mat, detections)
+
+	data, err := cam.grabFrameJPEG(mat, encodeConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if thumbnailWidth < mat.Cols() {
+		thumbnailHeight := mat.Rows() * thumbnailWidth / mat.Cols()
+		gocv.Resize(mat, &mat, image.Pt(thumbnailWidth, thumbnailHeight), 0, 0, gocv.InterpolationArea)
+	}
+
+	thumbnail, err := cam.grabFrameJPEG(mat, encodeConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Snapshot{Image: data, Thumbnail: thumbnail, Timestamp: now}, nil
+}
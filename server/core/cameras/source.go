@@ -0,0 +1,201 @@
+// core/cameras/source.go
+package cameras
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"smuggr.xyz/gatecam/common/config"
+
+	"gocv.io/x/gocv"
+)
+
+type FrameSource interface {
+	Open() error
+	IsOpened() bool
+	Read(mat *gocv.Mat) error
+	SetResolution(width, height int)
+	Resolution() (int, int)
+	Close() error
+}
+
+type SeekableSource interface {
+	FrameSource
+	Seek(position time.Duration) error
+	Position() time.Duration
+	Duration() time.Duration
+}
+
+type SourceFactory func(camConfig config.CameraConfig) (FrameSource, error)
+
+var (
+	sourceFactories   = make(map[config.SourceType]SourceFactory)
+	sourceFactoriesMu sync.RWMutex
+)
+
+func RegisterSource(sourceType config.SourceType, factory SourceFactory) {
+	sourceFactoriesMu.Lock()
+	defer sourceFactoriesMu.Unlock()
+	sourceFactories[sourceType] = factory
+}
+
+func resolveSourceType(camConfig config.CameraConfig) config.SourceType {
+	if camConfig.Source.Type != "" {
+		return camConfig.Source.Type
+	}
+	if camConfig.IsDisplay {
+		return config.SourceDisplay
+	}
+	return config.SourceDevice
+}
+
+func NewFrameSource(camConfig config.CameraConfig) (FrameSource, error) {
+	sourceType := resolveSourceType(camConfig)
+
+	sourceFactoriesMu.RLock()
+	factory, ok := sourceFactories[sourceType]
+	sourceFactoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported source type: %s", sourceType)
+	}
+
+	source, err := factory(camConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := source.Open(); err != nil {
+		return nil, err
+	}
+
+	return source, nil
+}
+
+// Used by sources that are not paced by hardware, so that they deliver frames
+// at a steady rate just like a real device would.
+type framePacer struct {
+	interval time.Duration
+	next     time.Time
+}
+
+func newFramePacer(frameRate float64) *framePacer {
+	fp := &framePacer{}
+	fp.setRate(frameRate)
+	return fp
+}
+
+func (fp *framePacer) setRate(frameRate float64) {
+	if frameRate <= 0 {
+		frameRate = defaultSourceFrameRate
+	}
+	fp.interval = time.Duration(float64(time.Second) / frameRate)
+}
+
+func (fp *framePacer) reset() {
+	fp.next = time.Now()
+}
+
+func (fp *framePacer) wait() {
+	if wait := time.Until(fp.next); wait > 0 {
+		time.Sleep(wait)
+	}
+
+	fp.next = fp.next.Add(fp.interval)
+	if time.Until(fp.next) < -fp.interval {
+		fp.next = time.Now()
+	}
+}
+
+const (
+	defaultSourceFrameRate    = 30 // Pace of generated and file sources without a frame_rate
+	defaultSourceTimeout      = 10 * time.Second
+	defaultSourceReconnectMin = 1 * time.Second
+	defaultSourceReconnectMax = 30 * time.Second
+)
+
+func sourceTimeout(sourceConfig config.SourceConfig) time.Duration {
+	if sourceConfig.Timeout > 0 {
+		return sourceConfig.Timeout
+	}
+	return defaultSourceTimeout
+}
+
+func sourcePassword(sourceConfig config.SourceConfig) string {
+	if sourceConfig.PasswordEnv == "" {
+		return ""
+	}
+	return os.Getenv(sourceConfig.PasswordEnv)
+}
+
+// Exponential backoff between reconnect attempts of network sources. It is
+// safe to use from several goroutines, so sources can wait on it without
+// holding their own lock.
+type reconnectBackoff struct {
+	minDelay    time.Duration
+	maxDelay    time.Duration
+	current     time.Duration
+	nextAttempt time.Time
+	mu          sync.Mutex
+}
+
+func newReconnectBackoff(sourceConfig config.SourceConfig) *reconnectBackoff {
+	minDelay, maxDelay := sourceConfig.ReconnectMin, sourceConfig.ReconnectMax
+	if minDelay <= 0 {
+		minDelay = defaultSourceReconnectMin
+	}
+	if maxDelay < minDelay {
+		maxDelay = defaultSourceReconnectMax
+	}
+	if maxDelay < minDelay {
+		maxDelay = minDelay
+	}
+
+	return &reconnectBackoff{minDelay: minDelay, maxDelay: maxDelay}
+}
+
+func (rb *reconnectBackoff) failed() time.Duration {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	if rb.current == 0 {
+		rb.current = rb.minDelay
+	} else {
+		rb.current *= 2
+		if rb.current > rb.maxDelay {
+			rb.current = rb.maxDelay
+		}
+	}
+
+	rb.nextAttempt = time.Now().Add(rb.current)
+	return rb.current
+}
+
+func (rb *reconnectBackoff) succeeded() {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	rb.current = 0
+	rb.nextAttempt = time.Time{}
+}
+
+// Returns false when done was closed before the next attempt was due.
+func (rb *reconnectBackoff) wait(done <-chan struct{}) bool {
+	rb.mu.Lock()
+	delay := time.Until(rb.nextAttempt)
+	rb.mu.Unlock()
+	if delay <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-done:
+		return false
+	}
+}
@@ -0,0 +1,140 @@
+// core/cameras/source_device.go
+package cameras
+
+import (
+	"fmt"
+	"sync"
+
+	"smuggr.xyz/gatecam/common/config"
+
+	"gocv.io/x/gocv"
+)
+
+type deviceSource struct {
+	device  int
+	width   int
+	height  int
+	capture *gocv.VideoCapture
+	closed  bool // A read racing Close must not reopen the device
+	mu      sync.Mutex
+}
+
+func init() {
+	RegisterSource(config.SourceDevice, newDeviceSource)
+}
+
+func newDeviceSource(camConfig config.CameraConfig) (FrameSource, error) {
+	return &deviceSource{
+		device: camConfig.Device,
+		width:  camConfig.FrameWidth,
+		height: camConfig.FrameHeight,
+	}, nil
+}
+
+func (ds *deviceSource) Open() error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	ds.closed = false
+	return ds.open()
+}
+
+func (ds *deviceSource) open() error {
+	cap, err := gocv.OpenVideoCapture(ds.device)
+	if err != nil {
+		return fmt.Errorf("error opening camera %d: %v", ds.device, err)
+	}
+
+	if ds.width > 0 {
+		cap.Set(gocv.VideoCaptureFrameWidth, float64(ds.width))
+	}
+	if ds.height > 0 {
+		cap.Set(gocv.VideoCaptureFrameHeight, float64(ds.height))
+	}
+
+	ds.capture = cap
+	return nil
+}
+
+func (ds *deviceSource) IsOpened() bool {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	return ds.capture != nil && ds.capture.IsOpened()
+}
+
+func (ds *deviceSource) recover() error {
+	if ds.closed {
+		return fmt.Errorf("device %d is closed", ds.device)
+	}
+
+	if ds.capture != nil {
+		if ds.capture.IsOpened() {
+			return nil
+		}
+		ds.capture.Close()
+		ds.capture = nil
+	}
+
+	fmt.Printf("device %d disconnected, attempting to reinitialize\n", ds.device)
+	return ds.open()
+}
+
+func (ds *deviceSource) Read(mat *gocv.Mat) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if err := ds.recover(); err != nil {
+		return fmt.Errorf("device %d is not initialized or disconnected: %v", ds.device, err)
+	}
+
+	if !ds.capture.Read(mat) || mat.Empty() {
+		return fmt.Errorf("failed to read frame from device %d", ds.device)
+	}
+
+	return nil
+}
+
+func (ds *deviceSource) SetResolution(width, height int) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	ds.width = width
+	ds.height = height
+
+	if ds.capture != nil && ds.capture.IsOpened() {
+		if width > 0 {
+			ds.capture.Set(gocv.VideoCaptureFrameWidth, float64(width))
+		}
+		if height > 0 {
+			ds.capture.Set(gocv.VideoCaptureFrameHeight, float64(height))
+		}
+	}
+}
+
+func (ds *deviceSource) Resolution() (int, int) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if ds.capture != nil && ds.capture.IsOpened() {
+		w := ds.capture.Get(gocv.VideoCaptureFrameWidth)
+		h := ds.capture.Get(gocv.VideoCaptureFrameHeight)
+		return int(w), int(h)
+	}
+
+	return 0, 0
+}
+
+func (ds *deviceSource) Close() error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	ds.closed = true
+	if ds.capture == nil {
+		return nil
+	}
+
+	err := ds.capture.Close()
+	ds.capture = nil
+	return err
+}
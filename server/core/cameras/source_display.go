@@ -0,0 +1,79 @@
+// core/cameras/source_display.go
+package cameras
+
+import (
+	"fmt"
+
+	"smuggr.xyz/gatecam/common/config"
+
+	"github.com/kbinani/screenshot"
+	"gocv.io/x/gocv"
+)
+
+type displaySource struct {
+	displayIndex int
+	width        int
+	height       int
+}
+
+func init() {
+	RegisterSource(config.SourceDisplay, newDisplaySource)
+}
+
+func newDisplaySource(camConfig config.CameraConfig) (FrameSource, error) {
+	return &displaySource{
+		displayIndex: camConfig.DisplayIndex,
+		width:        camConfig.FrameWidth,
+		height:       camConfig.FrameHeight,
+	}, nil
+}
+
+func (ds *displaySource) Open() error {
+	if screenshot.GetDisplayBounds(ds.displayIndex).Empty() {
+		return fmt.Errorf("invalid display bounds for index %d", ds.displayIndex)
+	}
+	return nil
+}
+
+func (ds *displaySource) IsOpened() bool {
+	return !screenshot.GetDisplayBounds(ds.displayIndex).Empty()
+}
+
+func (ds *displaySource) Read(mat *gocv.Mat) error {
+	bounds := screenshot.GetDisplayBounds(ds.displayIndex)
+	if bounds.Empty() {
+		return fmt.Errorf("invalid display bounds for index %d", ds.displayIndex)
+	}
+
+	img, err := screenshot.CaptureRect(bounds)
+	if err != nil {
+		return fmt.Errorf("failed to capture display %d: %v", ds.displayIndex, err)
+	}
+
+	matRGB, err := gocv.ImageToMatRGB(img)
+	if err != nil {
+		return fmt.Errorf("failed to convert screenshot to Mat: %v", err)
+	}
+	defer matRGB.Close()
+
+	gocv.CvtColor(matRGB, mat, gocv.ColorRGBToBGR)
+	return nil
+}
+
+func (ds *displaySource) SetResolution(width, height int) {
+	ds.width = width
+	ds.height = height
+	fmt.Printf("SetResolution() called on display %d. Updated config only.\n", ds.displayIndex)
+}
+
+func (ds *displaySource) Resolution() (int, int) {
+	bounds := screenshot.GetDisplayBounds(ds.displayIndex)
+	if bounds.Empty() {
+		return ds.width, ds.height
+	}
+	return bounds.Dx(), bounds.Dy()
+}
+
+func (ds *displaySource) Close() error {
+	return nil
+}
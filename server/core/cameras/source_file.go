@@ -0,0 +1,302 @@
+// core/cameras/source_file.go
+package cameras
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"smuggr.xyz/gatecam/common/config"
+
+	"gocv.io/x/gocv"
+)
+
+var imageSequenceExtensions = []string{".jpg", ".jpeg", ".png"}
+
+type fileSource struct {
+	path       string
+	playback   config.PlaybackMode
+	nativeRate bool
+	frameRate  float64
+	width      int
+	height     int
+	video      *gocv.VideoCapture
+	frames     []string
+	index      int
+	finished   bool
+	pacer      *framePacer
+	mu         sync.Mutex
+}
+
+func init() {
+	RegisterSource(config.SourceFile, newFileSource)
+}
+
+func newFileSource(camConfig config.CameraConfig) (FrameSource, error) {
+	if camConfig.Source.Path == "" {
+		return nil, fmt.Errorf("file source requires a path")
+	}
+
+	playback := camConfig.Source.Playback
+	switch playback {
+	case "":
+		playback = config.PlaybackLoop
+	case config.PlaybackLoop, config.PlaybackOnce:
+	default:
+		return nil, fmt.Errorf("unsupported playback mode: %s", playback)
+	}
+
+	frameRate := float64(camConfig.Source.FrameRate)
+	if frameRate <= 0 {
+		frameRate = float64(camConfig.FrameRate)
+	}
+	if frameRate <= 0 {
+		frameRate = defaultSourceFrameRate
+	}
+
+	return &fileSource{
+		path:       camConfig.Source.Path,
+		playback:   playback,
+		nativeRate: camConfig.Source.NativeRate,
+		frameRate:  frameRate,
+		pacer:      newFramePacer(frameRate),
+	}, nil
+}
+
+func listImageSequence(path string) ([]string, error) {
+	pattern := path
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		pattern = filepath.Join(path, "*")
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid frame pattern %s: %v", pattern, err)
+	}
+
+	frames := []string{}
+	for _, match := range matches {
+		ext := strings.ToLower(filepath.Ext(match))
+		for _, allowed := range imageSequenceExtensions {
+			if ext == allowed {
+				frames = append(frames, match)
+				break
+			}
+		}
+	}
+	sort.Strings(frames)
+
+	return frames, nil
+}
+
+func (fs *fileSource) isImageSequence() bool {
+	if strings.ContainsAny(fs.path, "*?[") {
+		return true
+	}
+	info, err := os.Stat(fs.path)
+	return err == nil && info.IsDir()
+}
+
+func (fs *fileSource) Open() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.isImageSequence() {
+		// Image sequences have no rate of their own
+		if fs.nativeRate {
+			return fmt.Errorf("native_rate only applies to video files, %s is an image sequence", fs.path)
+		}
+
+		frames, err := listImageSequence(fs.path)
+		if err != nil {
+			return err
+		}
+		if len(frames) == 0 {
+			return fmt.Errorf("no JPEG/PNG frames found in %s", fs.path)
+		}
+		fs.frames = frames
+
+		first := gocv.IMRead(frames[0], gocv.IMReadColor)
+		fs.width, fs.height = first.Cols(), first.Rows()
+		first.Close()
+	} else {
+		video, err := gocv.VideoCaptureFile(fs.path)
+		if err != nil {
+			return fmt.Errorf("error opening video file %s: %v", fs.path, err)
+		}
+		fs.video = video
+		fs.width = int(video.Get(gocv.VideoCaptureFrameWidth))
+		fs.height = int(video.Get(gocv.VideoCaptureFrameHeight))
+
+		if nativeRate := video.Get(gocv.VideoCaptureFPS); fs.nativeRate && nativeRate > 0 {
+			fs.frameRate = nativeRate
+		}
+	}
+
+	fs.pacer.setRate(fs.frameRate)
+	fs.pacer.reset()
+	fs.index = 0
+	fs.finished = false
+	return nil
+}
+
+func (fs *fileSource) IsOpened() bool {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return fs.frames != nil || (fs.video != nil && fs.video.IsOpened())
+}
+
+func (fs *fileSource) Read(mat *gocv.Mat) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.pacer.wait()
+
+	if fs.finished {
+		return io.EOF
+	}
+
+	if fs.frames != nil {
+		return fs.readImage(mat)
+	}
+	if fs.video != nil {
+		return fs.readVideo(mat)
+	}
+
+	return fmt.Errorf("file source %s is closed", fs.path)
+}
+
+func (fs *fileSource) readImage(mat *gocv.Mat) error {
+	if fs.index >= len(fs.frames) {
+		if fs.playback == config.PlaybackOnce {
+			fs.finished = true
+			return io.EOF
+		}
+		fs.index = 0
+	}
+
+	frame := gocv.IMRead(fs.frames[fs.index], gocv.IMReadColor)
+	defer frame.Close()
+	fs.index++
+
+	if frame.Empty() {
+		return fmt.Errorf("failed to read frame %s", fs.frames[fs.index-1])
+	}
+
+	frame.CopyTo(mat)
+	return nil
+}
+
+func (fs *fileSource) readVideo(mat *gocv.Mat) error {
+	if fs.video.Read(mat) && !mat.Empty() {
+		return nil
+	}
+
+	if fs.playback == config.PlaybackOnce {
+		fs.finished = true
+		return io.EOF
+	}
+
+	fs.video.Set(gocv.VideoCapturePosFrames, 0)
+	if !fs.video.Read(mat) || mat.Empty() {
+		return fmt.Errorf("failed to read frame from %s", fs.path)
+	}
+
+	return nil
+}
+
+func (fs *fileSource) Seek(position time.Duration) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if position < 0 {
+		return fmt.Errorf("invalid seek position: %v", position)
+	}
+
+	if fs.frames != nil {
+		index := int(position.Seconds() * fs.frameRate)
+		if index >= len(fs.frames) {
+			return fmt.Errorf("seek position %v is past the end of %s", position, fs.path)
+		}
+		fs.index = index
+	} else if fs.video != nil {
+		if duration := fs.duration(); duration > 0 && position > duration {
+			return fmt.Errorf("seek position %v is past the end of %s", position, fs.path)
+		}
+		fs.video.Set(gocv.VideoCapturePosMsec, float64(position.Milliseconds()))
+	} else {
+		return fmt.Errorf("file source %s is closed", fs.path)
+	}
+
+	fs.finished = false
+	fs.pacer.reset()
+	return nil
+}
+
+func (fs *fileSource) Position() time.Duration {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.frames != nil {
+		return time.Duration(float64(fs.index) / fs.frameRate * float64(time.Second))
+	}
+	if fs.video != nil {
+		return time.Duration(fs.video.Get(gocv.VideoCapturePosMsec)) * time.Millisecond
+	}
+
+	return 0
+}
+
+func (fs *fileSource) Duration() time.Duration {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return fs.duration()
+}
+
+func (fs *fileSource) duration() time.Duration {
+	if fs.frames != nil {
+		return time.Duration(float64(len(fs.frames)) / fs.frameRate * float64(time.Second))
+	}
+
+	if fs.video != nil {
+		frameCount := fs.video.Get(gocv.VideoCaptureFrameCount)
+		fps := fs.video.Get(gocv.VideoCaptureFPS)
+		if frameCount > 0 && fps > 0 {
+			return time.Duration(frameCount / fps * float64(time.Second))
+		}
+	}
+
+	return 0
+}
+
+func (fs *fileSource) SetResolution(width, height int) {
+	fmt.Printf("SetResolution() called on file source %s. Playback keeps the recorded resolution.\n", fs.path)
+}
+
+func (fs *fileSource) Resolution() (int, int) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return fs.width, fs.height
+}
+
+func (fs *fileSource) Close() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.frames = nil
+	if fs.video == nil {
+		return nil
+	}
+
+	err := fs.video.Close()
+	fs.video = nil
+	return err
+}
@@ -0,0 +1,249 @@
+// core/cameras/source_mjpeg.go
+package cameras
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"smuggr.xyz/gatecam/common/config"
+
+	"gocv.io/x/gocv"
+)
+
+const maxMJPEGPartSize = 16 << 20
+
+type mjpegSource struct {
+	url        string
+	displayURL string
+	username   string
+	password   string
+	timeout    time.Duration
+	client     *http.Client
+	backoff    *reconnectBackoff
+	frames     chan []byte
+	connected  bool
+	width      int
+	height     int
+	done       chan struct{}
+	closeOnce  sync.Once
+	wg         sync.WaitGroup
+	mu         sync.Mutex
+}
+
+func init() {
+	RegisterSource(config.SourceMJPEG, newMJPEGSource)
+}
+
+func newMJPEGSource(camConfig config.CameraConfig) (FrameSource, error) {
+	sourceConfig := camConfig.Source
+
+	streamURL, err := url.Parse(sourceConfig.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MJPEG url: %v", err)
+	}
+	if streamURL.Scheme != "http" && streamURL.Scheme != "https" {
+		return nil, fmt.Errorf("invalid MJPEG url scheme: %s", streamURL.Scheme)
+	}
+
+	timeout := sourceTimeout(sourceConfig)
+	dialer := &net.Dialer{Timeout: timeout}
+
+	return &mjpegSource{
+		url:        streamURL.String(),
+		displayURL: streamURL.Redacted(),
+		username:   sourceConfig.Username,
+		password:   sourcePassword(sourceConfig),
+		timeout:    timeout,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				DialContext:           dialer.DialContext,
+				TLSHandshakeTimeout:   timeout,
+				ResponseHeaderTimeout: timeout,
+			},
+		},
+		backoff: newReconnectBackoff(sourceConfig),
+		frames:  make(chan []byte, 1),
+		done:    make(chan struct{}),
+	}, nil
+}
+
+func (ms *mjpegSource) Open() error {
+	ms.wg.Add(1)
+	go ms.run()
+	return nil
+}
+
+func (ms *mjpegSource) run() {
+	defer ms.wg.Done()
+
+	for {
+		if !ms.backoff.wait(ms.done) {
+			return
+		}
+
+		err := ms.stream()
+
+		ms.mu.Lock()
+		ms.connected = false
+		ms.mu.Unlock()
+
+		select {
+		case <-ms.done:
+			return
+		default:
+		}
+
+		fmt.Printf("MJPEG source %s: %v, retrying in %v\n", ms.displayURL, err, ms.backoff.failed())
+	}
+}
+
+func (ms *mjpegSource) stream() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-ms.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ms.url, nil)
+	if err != nil {
+		return err
+	}
+	if ms.username != "" {
+		req.SetBasicAuth(ms.username, ms.password)
+	}
+
+	resp, err := ms.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return fmt.Errorf("invalid content type: %v", err)
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" {
+		return fmt.Errorf("not a multipart stream: %s", mediaType)
+	}
+
+	// Some cameras send the boundary with the leading dashes included
+	boundary := strings.TrimPrefix(params["boundary"], "--")
+	reader := multipart.NewReader(resp.Body, boundary)
+
+	// A stalled upstream never returns from NextPart, so cancel the request instead
+	watchdog := time.AfterFunc(ms.timeout, cancel)
+	defer watchdog.Stop()
+
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return fmt.Errorf("stream ended: %v", err)
+		}
+
+		data, err := io.ReadAll(io.LimitReader(part, maxMJPEGPartSize))
+		part.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read frame: %v", err)
+		}
+		watchdog.Reset(ms.timeout)
+
+		if len(data) == 0 {
+			continue
+		}
+
+		ms.mu.Lock()
+		if !ms.connected {
+			ms.connected = true
+			ms.backoff.succeeded()
+		}
+		ms.mu.Unlock()
+
+		ms.publish(data)
+	}
+}
+
+// Keeps only the newest frame, a slow reader never stalls the upstream connection.
+func (ms *mjpegSource) publish(data []byte) {
+	for {
+		select {
+		case ms.frames <- data:
+			return
+		default:
+		}
+
+		select {
+		case <-ms.frames:
+		default:
+		}
+	}
+}
+
+func (ms *mjpegSource) IsOpened() bool {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	return ms.connected
+}
+
+func (ms *mjpegSource) Read(mat *gocv.Mat) error {
+	timer := time.NewTimer(ms.timeout)
+	defer timer.Stop()
+
+	var data []byte
+	select {
+	case data = <-ms.frames:
+	case <-timer.C:
+		return fmt.Errorf("timed out waiting for a frame from %s", ms.displayURL)
+	case <-ms.done:
+		return fmt.Errorf("MJPEG source %s is closed", ms.displayURL)
+	}
+
+	if err := gocv.IMDecodeIntoMat(data, gocv.IMReadColor, mat); err != nil {
+		return fmt.Errorf("failed to decode frame from %s: %v", ms.displayURL, err)
+	}
+	if mat.Empty() {
+		return fmt.Errorf("failed to decode frame from %s", ms.displayURL)
+	}
+
+	ms.mu.Lock()
+	ms.width, ms.height = mat.Cols(), mat.Rows()
+	ms.mu.Unlock()
+
+	return nil
+}
+
+func (ms *mjpegSource) SetResolution(width, height int) {
+	fmt.Printf("SetResolution() called on MJPEG source %s. Resolution is set by the camera.\n", ms.displayURL)
+}
+
+func (ms *mjpegSource) Resolution() (int, int) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	return ms.width, ms.height
+}
+
+func (ms *mjpegSource) Close() error {
+	ms.closeOnce.Do(func() { close(ms.done) })
+	ms.wg.Wait()
+	return nil
+}
@@ -0,0 +1,198 @@
+// core/cameras/source_mjpeg_test.go
+package cameras
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"smuggr.xyz/gatecam/common/config"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	testFrameWidth  = 64
+	testFrameHeight = 48
+)
+
+func testJPEG(t *testing.T) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	img := image.NewRGBA(image.Rect(0, 0, testFrameWidth, testFrameHeight))
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Serves multipart/x-mixed-replace JPEG parts like an IP camera. Every
+// connection gets the given number of parts and is then dropped, a negative
+// number keeps the connection open without sending anything.
+type mjpegServer struct {
+	*httptest.Server
+	mu          sync.Mutex
+	connections []time.Time
+	dropped     []time.Time
+}
+
+func newMJPEGServer(t *testing.T, frame []byte, parts int) *mjpegServer {
+	t.Helper()
+
+	ms := &mjpegServer{}
+	ms.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ms.mu.Lock()
+		ms.connections = append(ms.connections, time.Now())
+		ms.mu.Unlock()
+
+		w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary=frame")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+
+		if parts < 0 {
+			<-r.Context().Done()
+			return
+		}
+
+		for i := 0; i < parts; i++ {
+			fmt.Fprintf(w, "--frame\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", len(frame))
+			w.Write(frame)
+			fmt.Fprint(w, "\r\n")
+			w.(http.Flusher).Flush()
+
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+
+		ms.mu.Lock()
+		ms.dropped = append(ms.dropped, time.Now())
+		ms.mu.Unlock()
+	}))
+	t.Cleanup(ms.Close)
+
+	return ms
+}
+
+func (ms *mjpegServer) times() ([]time.Time, []time.Time) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	return append([]time.Time(nil), ms.connections...), append([]time.Time(nil), ms.dropped...)
+}
+
+func openMJPEGSource(t *testing.T, url string, reconnectMin time.Duration) FrameSource {
+	t.Helper()
+
+	source, err := newMJPEGSource(config.CameraConfig{
+		Source: config.SourceConfig{
+			Type:         config.SourceMJPEG,
+			URL:          url,
+			Timeout:      2 * time.Second,
+			ReconnectMin: reconnectMin,
+			ReconnectMax: 2 * reconnectMin,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := source.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { source.Close() })
+
+	return source
+}
+
+func TestMJPEGSourceReadDecodesFrames(t *testing.T) {
+	server := newMJPEGServer(t, testJPEG(t), 100)
+	source := openMJPEGSource(t, server.URL, 50*time.Millisecond)
+
+	mat := gocv.NewMat()
+	defer mat.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := source.Read(&mat); err != nil {
+			t.Fatalf("read %d: %v", i, err)
+		}
+		if mat.Cols() != testFrameWidth || mat.Rows() != testFrameHeight {
+			t.Fatalf("expected %dx%d, got %dx%d", testFrameWidth, testFrameHeight, mat.Cols(), mat.Rows())
+		}
+	}
+
+	if !source.IsOpened() {
+		t.Fatal("source is not opened while streaming")
+	}
+	if w, h := source.Resolution(); w != testFrameWidth || h != testFrameHeight {
+		t.Fatalf("expected resolution %dx%d, got %dx%d", testFrameWidth, testFrameHeight, w, h)
+	}
+}
+
+func TestMJPEGSourceReconnectsWithBackoff(t *testing.T) {
+	const reconnectMin = 200 * time.Millisecond
+
+	server := newMJPEGServer(t, testJPEG(t), 2)
+	source := openMJPEGSource(t, server.URL, reconnectMin)
+
+	mat := gocv.NewMat()
+	defer mat.Close()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		connections, _ := server.times()
+		if len(connections) >= 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 3 connections, got %d", len(connections))
+		}
+
+		// Reads fail while the source waits to reconnect and succeed again after
+		source.Read(&mat)
+	}
+
+	if err := source.Read(&mat); err != nil {
+		t.Fatalf("read after reconnecting: %v", err)
+	}
+
+	connections, dropped := server.times()
+	for i := 1; i < len(connections); i++ {
+		if gap := connections[i].Sub(dropped[i-1]); gap < reconnectMin {
+			t.Fatalf("reconnect %d came %v after the drop, expected at least %v", i, gap, reconnectMin)
+		}
+	}
+}
+
+func TestMJPEGSourceCloseUnblocksRead(t *testing.T) {
+	server := newMJPEGServer(t, nil, -1)
+	source := openMJPEGSource(t, server.URL, 50*time.Millisecond)
+
+	mat := gocv.NewMat()
+	defer mat.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- source.Read(&mat)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	source.Close()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected an error from a closed source")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Read did not return after Close")
+	}
+}
@@ -0,0 +1,161 @@
+// core/cameras/source_rtsp.go
+package cameras
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+
+	"smuggr.xyz/gatecam/common/config"
+
+	"gocv.io/x/gocv"
+)
+
+// Not exposed by gocv, see cv::CAP_PROP_OPEN_TIMEOUT_MSEC and cv::CAP_PROP_READ_TIMEOUT_MSEC
+const (
+	videoCaptureOpenTimeoutMsec gocv.VideoCaptureProperties = 53
+	videoCaptureReadTimeoutMsec gocv.VideoCaptureProperties = 54
+)
+
+type rtspSource struct {
+	url        string
+	displayURL string
+	params     []gocv.VideoCaptureProperties
+	capture    *gocv.VideoCapture
+	backoff    *reconnectBackoff
+	done       chan struct{}
+	closeOnce  sync.Once
+	mu         sync.Mutex
+}
+
+func init() {
+	RegisterSource(config.SourceRTSP, newRTSPSource)
+}
+
+func newRTSPSource(camConfig config.CameraConfig) (FrameSource, error) {
+	sourceConfig := camConfig.Source
+
+	streamURL, err := url.Parse(sourceConfig.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RTSP url: %v", err)
+	}
+	if streamURL.Scheme != "rtsp" && streamURL.Scheme != "rtsps" {
+		return nil, fmt.Errorf("invalid RTSP url scheme: %s", streamURL.Scheme)
+	}
+
+	displayURL := streamURL.Redacted()
+	if sourceConfig.Username != "" {
+		streamURL.User = url.UserPassword(sourceConfig.Username, sourcePassword(sourceConfig))
+	}
+
+	timeoutMsec := gocv.VideoCaptureProperties(sourceTimeout(sourceConfig).Milliseconds())
+
+	return &rtspSource{
+		url:        streamURL.String(),
+		displayURL: displayURL,
+		params: []gocv.VideoCaptureProperties{
+			videoCaptureOpenTimeoutMsec, timeoutMsec,
+			videoCaptureReadTimeoutMsec, timeoutMsec,
+		},
+		backoff: newReconnectBackoff(sourceConfig),
+		done:    make(chan struct{}),
+	}, nil
+}
+
+func (rs *rtspSource) Open() error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	// An unreachable camera is not fatal, Read keeps reconnecting
+	if err := rs.connect(); err != nil {
+		fmt.Printf("%v, retrying in %v\n", err, rs.backoff.failed())
+	}
+	return nil
+}
+
+func (rs *rtspSource) connect() error {
+	cap, err := gocv.OpenVideoCaptureWithAPIParams(rs.url, gocv.VideoCaptureFFmpeg, rs.params)
+	if err != nil {
+		if cap != nil {
+			cap.Close()
+		}
+		return fmt.Errorf("error opening RTSP stream %s: %v", rs.displayURL, err)
+	}
+
+	rs.capture = cap
+	rs.backoff.succeeded()
+	return nil
+}
+
+func (rs *rtspSource) disconnect() {
+	if rs.capture != nil {
+		rs.capture.Close()
+		rs.capture = nil
+	}
+}
+
+func (rs *rtspSource) IsOpened() bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	return rs.capture != nil && rs.capture.IsOpened()
+}
+
+func (rs *rtspSource) Read(mat *gocv.Mat) error {
+	rs.mu.Lock()
+	connected := rs.capture != nil
+	rs.mu.Unlock()
+
+	// The backoff can last up to reconnect_max, status calls must not wait for it
+	if !connected && !rs.backoff.wait(rs.done) {
+		return fmt.Errorf("RTSP source %s is closed", rs.displayURL)
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if rs.capture == nil {
+		select {
+		case <-rs.done:
+			return fmt.Errorf("RTSP source %s is closed", rs.displayURL)
+		default:
+		}
+		if err := rs.connect(); err != nil {
+			return fmt.Errorf("%v, retrying in %v", err, rs.backoff.failed())
+		}
+	}
+
+	if !rs.capture.Read(mat) || mat.Empty() {
+		rs.disconnect()
+		return fmt.Errorf("lost RTSP stream %s, retrying in %v", rs.displayURL, rs.backoff.failed())
+	}
+
+	return nil
+}
+
+func (rs *rtspSource) SetResolution(width, height int) {
+	fmt.Printf("SetResolution() called on RTSP source %s. Resolution is set by the camera.\n", rs.displayURL)
+}
+
+func (rs *rtspSource) Resolution() (int, int) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if rs.capture != nil && rs.capture.IsOpened() {
+		w := rs.capture.Get(gocv.VideoCaptureFrameWidth)
+		h := rs.capture.Get(gocv.VideoCaptureFrameHeight)
+		return int(w), int(h)
+	}
+
+	return 0, 0
+}
+
+func (rs *rtspSource) Close() error {
+	rs.closeOnce.Do(func() { close(rs.done) })
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	rs.disconnect()
+	return nil
+}
@@ -0,0 +1,205 @@
+// core/cameras/source_test_pattern.go
+package cameras
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"sync"
+	"time"
+
+	"smuggr.xyz/gatecam/common/config"
+
+	"gocv.io/x/gocv"
+)
+
+var (
+	smpteTopBars = []color.RGBA{
+		{191, 191, 191, 0}, {191, 191, 0, 0}, {0, 191, 191, 0}, {0, 191, 0, 0},
+		{191, 0, 191, 0}, {191, 0, 0, 0}, {0, 0, 191, 0},
+	}
+	smpteMiddleBars = []color.RGBA{
+		{0, 0, 191, 0}, {19, 19, 19, 0}, {191, 0, 191, 0}, {19, 19, 19, 0},
+		{0, 191, 191, 0}, {19, 19, 19, 0}, {191, 191, 191, 0},
+	}
+	smpteBottomBars = []color.RGBA{
+		{0, 33, 76, 0}, {255, 255, 255, 0}, {50, 0, 106, 0}, {19, 19, 19, 0},
+		{9, 9, 9, 0}, {19, 19, 19, 0}, {29, 29, 29, 0}, {19, 19, 19, 0},
+	}
+	smpteBottomWidths = []float64{5.0 / 28, 5.0 / 28, 5.0 / 28, 5.0 / 28, 1.0 / 21, 1.0 / 21, 1.0 / 21, 1.0 / 7}
+)
+
+type testPatternSource struct {
+	name      string
+	width     int
+	height    int
+	fixedSize bool
+	pacer     *framePacer
+	frame     uint64
+	opened    bool
+	mu        sync.Mutex
+}
+
+func init() {
+	RegisterSource(config.SourceTestPattern, newTestPatternSource)
+}
+
+func newTestPatternSource(camConfig config.CameraConfig) (FrameSource, error) {
+	width, height := camConfig.Source.Width, camConfig.Source.Height
+	fixedSize := width > 0 && height > 0
+	if !fixedSize {
+		width, height = camConfig.FrameWidth, camConfig.FrameHeight
+	}
+	if width <= 0 || height <= 0 {
+		width, height = 640, 480
+	}
+
+	frameRate := camConfig.Source.FrameRate
+	if frameRate <= 0 {
+		frameRate = camConfig.FrameRate
+	}
+	if frameRate <= 0 {
+		return nil, fmt.Errorf("invalid frame rate for test pattern source: %d", frameRate)
+	}
+
+	return &testPatternSource{
+		name:      camConfig.Name,
+		width:     width,
+		height:    height,
+		fixedSize: fixedSize,
+		pacer:     newFramePacer(float64(frameRate)),
+	}, nil
+}
+
+func (tps *testPatternSource) Open() error {
+	tps.mu.Lock()
+	defer tps.mu.Unlock()
+
+	tps.opened = true
+	tps.pacer.reset()
+	return nil
+}
+
+func (tps *testPatternSource) IsOpened() bool {
+	tps.mu.Lock()
+	defer tps.mu.Unlock()
+
+	return tps.opened
+}
+
+func (tps *testPatternSource) Read(mat *gocv.Mat) error {
+	tps.mu.Lock()
+	defer tps.mu.Unlock()
+
+	if !tps.opened {
+		return fmt.Errorf("test pattern source is closed")
+	}
+
+	tps.pacer.wait()
+
+	frame := gocv.NewMatWithSize(tps.height, tps.width, gocv.MatTypeCV8UC3)
+	defer frame.Close()
+
+	tps.drawBars(&frame)
+	tps.drawMovingBox(&frame)
+	tps.drawTimestamp(&frame)
+	tps.frame++
+
+	frame.CopyTo(mat)
+	return nil
+}
+
+func (tps *testPatternSource) drawBars(mat *gocv.Mat) {
+	topHeight := tps.height * 2 / 3
+	middleHeight := tps.height / 12
+
+	fillColumns(mat, smpteTopBars, nil, 0, topHeight)
+	fillColumns(mat, smpteMiddleBars, nil, topHeight, topHeight+middleHeight)
+	fillColumns(mat, smpteBottomBars, smpteBottomWidths, topHeight+middleHeight, tps.height)
+}
+
+func fillColumns(mat *gocv.Mat, colors []color.RGBA, widths []float64, top, bottom int) {
+	cols := mat.Cols()
+	x := 0.0
+	for i, c := range colors {
+		width := 1.0 / float64(len(colors))
+		if widths != nil {
+			width = widths[i]
+		}
+
+		x1 := int(x * float64(cols))
+		x += width
+		x2 := int(x * float64(cols))
+		if i == len(colors)-1 {
+			x2 = cols
+		}
+
+		gocv.Rectangle(mat, image.Rect(x1, top, x2, bottom), c, -1)
+	}
+}
+
+func (tps *testPatternSource) drawMovingBox(mat *gocv.Mat) {
+	size := tps.height / 6
+	if size < 8 {
+		size = 8
+	}
+
+	spanX := tps.width - size
+	spanY := tps.height*2/3 - size
+	if spanX <= 0 || spanY <= 0 {
+		return
+	}
+
+	x := bounce(int(tps.frame)*4, spanX)
+	y := bounce(int(tps.frame)*3, spanY)
+
+	box := image.Rect(x, y, x+size, y+size)
+	gocv.Rectangle(mat, box, color.RGBA{255, 255, 255, 0}, -1)
+	gocv.Rectangle(mat, box, color.RGBA{0, 0, 0, 0}, 2)
+}
+
+func bounce(pos, span int) int {
+	pos %= 2 * span
+	if pos > span {
+		return 2*span - pos
+	}
+	return pos
+}
+
+func (tps *testPatternSource) drawTimestamp(mat *gocv.Mat) {
+	text := fmt.Sprintf("%s %s #%d", tps.name, time.Now().Format("2006-01-02 15:04:05.000"), tps.frame)
+	scale := float64(tps.width) / 1280
+	if scale < 0.35 {
+		scale = 0.35
+	}
+
+	size := gocv.GetTextSize(text, gocv.FontHersheySimplex, scale, 1)
+	origin := image.Pt(8, size.Y+8)
+	gocv.Rectangle(mat, image.Rect(0, 0, size.X+16, size.Y+16), color.RGBA{0, 0, 0, 0}, -1)
+	gocv.PutText(mat, text, origin, gocv.FontHersheySimplex, scale, color.RGBA{255, 255, 255, 0}, 1)
+}
+
+func (tps *testPatternSource) SetResolution(width, height int) {
+	tps.mu.Lock()
+	defer tps.mu.Unlock()
+
+	if !tps.fixedSize && width > 0 && height > 0 {
+		tps.width = width
+		tps.height = height
+	}
+}
+
+func (tps *testPatternSource) Resolution() (int, int) {
+	tps.mu.Lock()
+	defer tps.mu.Unlock()
+
+	return tps.width, tps.height
+}
+
+func (tps *testPatternSource) Close() error {
+	tps.mu.Lock()
+	defer tps.mu.Unlock()
+
+	tps.opened = false
+	return nil
+}
@@ -0,0 +1,251 @@
+// core/cameras/tracker.go
+package cameras
+
+import (
+	"image"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"smuggr.xyz/gatecam/common/config"
+)
+
+const (
+	defaultNMSThreshold = 0.45
+	defaultTrackIoU     = 0.3
+	defaultTrackTTL     = 2 * time.Second
+
+	// Below this speed in pixels per second an entity counts as stationary
+	minTrackSpeed = 10.0
+	// Weight of the newest measurement in the smoothed velocity
+	velocitySmoothing = 0.5
+)
+
+type Direction string
+
+const (
+	DirectionStationary Direction = "stationary"
+	DirectionLeft       Direction = "left"
+	DirectionRight      Direction = "right"
+	DirectionUp         Direction = "up"
+	DirectionDown       Direction = "down"
+)
+
+type Velocity struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+func (v Velocity) Speed() float64 {
+	return math.Hypot(v.X, v.Y)
+}
+
+func (v Velocity) Direction() Direction {
+	if v.Speed() < minTrackSpeed {
+		return DirectionStationary
+	}
+
+	if math.Abs(v.X) >= math.Abs(v.Y) {
+		if v.X < 0 {
+			return DirectionLeft
+		}
+		return DirectionRight
+	}
+
+	if v.Y < 0 {
+		return DirectionUp
+	}
+	return DirectionDown
+}
+
+func rectIoU(a, b image.Rectangle) float64 {
+	inter := a.Intersect(b)
+	if inter.Empty() {
+		return 0
+	}
+
+	interArea := float64(inter.Dx() * inter.Dy())
+	unionArea := float64(a.Dx()*a.Dy()+b.Dx()*b.Dy()) - interArea
+	if unionArea <= 0 {
+		return 0
+	}
+
+	return interArea / unionArea
+}
+
+func rectCenter(r image.Rectangle) (float64, float64) {
+	return float64(r.Min.X+r.Max.X) / 2, float64(r.Min.Y+r.Max.Y) / 2
+}
+
+// Greedy per-label non-maximum suppression, the most confident box of every
+// overlapping group survives.
+func nonMaxSuppression(detections []Entity, threshold float64) []Entity {
+	sorted := make([]Entity, len(detections))
+	copy(sorted, detections)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Confidence > sorted[j].Confidence
+	})
+
+	kept := []Entity{}
+	for _, candidate := range sorted {
+		suppressed := false
+		for _, k := range kept {
+			if k.Label == candidate.Label && rectIoU(k.Rect, candidate.Rect) > threshold {
+				suppressed = true
+				break
+			}
+		}
+		if !suppressed {
+			kept = append(kept, candidate)
+		}
+	}
+
+	return kept
+}
+
+type track struct {
+	entity Entity
+}
+
+type Tracker struct {
+	tracks       map[uint64]*track
+	nextID       uint64
+	nmsThreshold float64
+	iouThreshold float64
+	ttl          time.Duration
+	mu           sync.Mutex
+}
+
+func NewTracker(detConfig config.DetectionConfig) *Tracker {
+	tracker := &Tracker{
+		tracks:       make(map[uint64]*track),
+		nmsThreshold: detConfig.NMSThreshold,
+		iouThreshold: detConfig.TrackIoU,
+		ttl:          detConfig.TrackTTL,
+	}
+
+	if tracker.nmsThreshold <= 0 {
+		tracker.nmsThreshold = defaultNMSThreshold
+	}
+	if tracker.iouThreshold <= 0 {
+		tracker.iouThreshold = defaultTrackIoU
+	}
+	if tracker.ttl <= 0 {
+		tracker.ttl = defaultTrackTTL
+	}
+
+	return tracker
+}
+
+type trackMatch struct {
+	trackID   uint64
+	detection int
+	score     float64
+}
+
+// Matches fresh detections to known tracks. Returns the entities seen in this
+// update together with the tracks that started and the ones that expired.
+func (t *Tracker) Update(detections []Entity, now time.Time) (active []Entity, appeared []Entity, disappeared []Entity) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	detections = nonMaxSuppression(detections, t.nmsThreshold)
+
+	matches := []trackMatch{}
+	for id, tr := range t.tracks {
+		for i, det := range detections {
+			if det.Label != tr.entity.Label {
+				continue
+			}
+
+			if iou := rectIoU(tr.entity.Rect, det.Rect); iou >= t.iouThreshold {
+				matches = append(matches, trackMatch{trackID: id, detection: i, score: 1 + iou})
+				continue
+			}
+
+			// Fast movers overlap little between updates, fall back to the
+			// distance of the centers relative to the size of the box
+			tx, ty := rectCenter(tr.entity.Rect)
+			dx, dy := rectCenter(det.Rect)
+			reach := math.Hypot(float64(tr.entity.Rect.Dx()), float64(tr.entity.Rect.Dy()))
+			if dist := math.Hypot(dx-tx, dy-ty); reach > 0 && dist < reach {
+				matches = append(matches, trackMatch{trackID: id, detection: i, score: 1 - dist/reach})
+			}
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	usedTracks := make(map[uint64]bool)
+	usedDetections := make(map[int]bool)
+	for _, m := range matches {
+		if usedTracks[m.trackID] || usedDetections[m.detection] {
+			continue
+		}
+		usedTracks[m.trackID] = true
+		usedDetections[m.detection] = true
+
+		tr := t.tracks[m.trackID]
+		tr.entity = t.advance(tr.entity, detections[m.detection], now)
+		active = append(active, tr.entity)
+	}
+
+	for i, det := range detections {
+		if usedDetections[i] {
+			continue
+		}
+
+		t.nextID++
+		det.TrackID = t.nextID
+		det.FirstSeen = now
+		det.LastSeen = now
+		det.Direction = DirectionStationary
+		t.tracks[det.TrackID] = &track{entity: det}
+
+		active = append(active, det)
+		appeared = append(appeared, det)
+	}
+
+	for id, tr := range t.tracks {
+		if !usedTracks[id] && now.Sub(tr.entity.LastSeen) > t.ttl {
+			delete(t.tracks, id)
+			disappeared = append(disappeared, tr.entity)
+		}
+	}
+
+	return active, appeared, disappeared
+}
+
+func (t *Tracker) advance(previous, det Entity, now time.Time) Entity {
+	det.TrackID = previous.TrackID
+	det.FirstSeen = previous.FirstSeen
+	det.LastSeen = now
+	det.Velocity = previous.Velocity
+
+	if elapsed := now.Sub(previous.LastSeen).Seconds(); elapsed > 0 {
+		px, py := rectCenter(previous.Rect)
+		cx, cy := rectCenter(det.Rect)
+		det.Velocity = Velocity{
+			X: velocitySmoothing*(cx-px)/elapsed + (1-velocitySmoothing)*previous.Velocity.X,
+			Y: velocitySmoothing*(cy-py)/elapsed + (1-velocitySmoothing)*previous.Velocity.Y,
+		}
+	}
+	det.Direction = det.Velocity.Direction()
+
+	return det
+}
+
+func (t *Tracker) Reset() []Entity {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	disappeared := make([]Entity, 0, len(t.tracks))
+	for id, tr := range t.tracks {
+		delete(t.tracks, id)
+		disappeared = append(disappeared, tr.entity)
+	}
+
+	return disappeared
+}
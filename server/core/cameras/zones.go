@@ -0,0 +1,299 @@
+// core/cameras/zones.go
+package cameras
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"sync"
+	"time"
+
+	"smuggr.xyz/gatecam/common/config"
+
+	"gocv.io/x/gocv"
+)
+
+type CrossingDirection string
+
+const (
+	CrossingLeftToRight CrossingDirection = "left_to_right"
+	CrossingRightToLeft CrossingDirection = "right_to_left"
+)
+
+var (
+	zoneColors = map[config.ZoneType]color.RGBA{
+		config.ZoneMonitor: {255, 200, 0, 0},
+		config.ZoneInclude: {0, 160, 255, 0},
+		config.ZoneExclude: {255, 0, 0, 0},
+	}
+	lineColor = color.RGBA{255, 0, 255, 0}
+)
+
+type point struct {
+	X, Y float64
+}
+
+// Where an entity touches the ground, in normalized frame coordinates
+func entityAnchor(entity Entity, width, height int) point {
+	return point{
+		X: float64(entity.Rect.Min.X+entity.Rect.Max.X) / 2 / float64(width),
+		Y: float64(entity.Rect.Max.Y) / float64(height),
+	}
+}
+
+func pointInPolygon(p point, polygon [][2]float64) bool {
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		xi, yi := polygon[i][0], polygon[i][1]
+		xj, yj := polygon[j][0], polygon[j][1]
+		if (yi > p.Y) != (yj > p.Y) && p.X < (xj-xi)*(p.Y-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+func sideOfLine(line config.LineConfig, p point) float64 {
+	return (line.To[0]-line.From[0])*(p.Y-line.From[1]) - (line.To[1]-line.From[1])*(p.X-line.From[0])
+}
+
+// Returns whether the movement from a to b crossed the line segment and in
+// which direction.
+func crossesLine(line config.LineConfig, a, b point) (CrossingDirection, bool) {
+	sideA, sideB := sideOfLine(line, a), sideOfLine(line, b)
+	if sideA == 0 || sideB == 0 || (sideA > 0) == (sideB > 0) {
+		return "", false
+	}
+
+	from, to := point{line.From[0], line.From[1]}, point{line.To[0], line.To[1]}
+	moveLine := config.LineConfig{From: [2]float64{a.X, a.Y}, To: [2]float64{b.X, b.Y}}
+	if (sideOfLine(moveLine, from) > 0) == (sideOfLine(moveLine, to) > 0) {
+		return "", false
+	}
+
+	// Image coordinates grow downwards, so a negative side is on the left
+	if sideA < 0 {
+		return CrossingLeftToRight, true
+	}
+	return CrossingRightToLeft, true
+}
+
+func validateZones(zones []config.ZoneConfig, lines []config.LineConfig) error {
+	names := make(map[string]bool)
+	for _, zone := range zones {
+		if zone.Name == "" {
+			return fmt.Errorf("zone without a name")
+		}
+		if names[zone.Name] {
+			return fmt.Errorf("duplicate zone or line name: %s", zone.Name)
+		}
+		names[zone.Name] = true
+
+		switch zone.Type {
+		case "", config.ZoneMonitor, config.ZoneInclude, config.ZoneExclude:
+		default:
+			return fmt.Errorf("invalid type of zone %s: %s", zone.Name, zone.Type)
+		}
+		if len(zone.Points) < 3 {
+			return fmt.Errorf("zone %s needs at least 3 points", zone.Name)
+		}
+		for _, p := range zone.Points {
+			if p[0] < 0 || p[0] > 1 || p[1] < 0 || p[1] > 1 {
+				return fmt.Errorf("zone %s has a point outside of the frame: %v", zone.Name, p)
+			}
+		}
+	}
+
+	for _, line := range lines {
+		if line.Name == "" {
+			return fmt.Errorf("line without a name")
+		}
+		if names[line.Name] {
+			return fmt.Errorf("duplicate zone or line name: %s", line.Name)
+		}
+		names[line.Name] = true
+
+		if line.From == line.To {
+			return fmt.Errorf("line %s has no length", line.Name)
+		}
+		for _, p := range [][2]float64{line.From, line.To} {
+			if p[0] < 0 || p[0] > 1 || p[1] < 0 || p[1] > 1 {
+				return fmt.Errorf("line %s has a point outside of the frame: %v", line.Name, p)
+			}
+		}
+	}
+
+	return nil
+}
+
+type zoneTrackState struct {
+	zones  map[string]bool
+	anchor point
+}
+
+type ZoneSet struct {
+	zones  []config.ZoneConfig
+	lines  []config.LineConfig
+	tracks map[uint64]zoneTrackState
+	mu     sync.RWMutex
+}
+
+func NewZoneSet(zones []config.ZoneConfig, lines []config.LineConfig) (*ZoneSet, error) {
+	zs := &ZoneSet{tracks: make(map[uint64]zoneTrackState)}
+	if err := zs.Set(zones, lines); err != nil {
+		return nil, err
+	}
+	return zs, nil
+}
+
+func (zs *ZoneSet) Set(zones []config.ZoneConfig, lines []config.LineConfig) error {
+	if err := validateZones(zones, lines); err != nil {
+		return err
+	}
+
+	normalized := make([]config.ZoneConfig, len(zones))
+	for i, zone := range zones {
+		if zone.Type == "" {
+			zone.Type = config.ZoneMonitor
+		}
+		normalized[i] = zone
+	}
+
+	zs.mu.Lock()
+	defer zs.mu.Unlock()
+
+	zs.zones = normalized
+	zs.lines = append([]config.LineConfig{}, lines...)
+	return nil
+}
+
+func (zs *ZoneSet) Get() ([]config.ZoneConfig, []config.LineConfig) {
+	zs.mu.RLock()
+	defer zs.mu.RUnlock()
+
+	return append([]config.ZoneConfig{}, zs.zones...), append([]config.LineConfig{}, zs.lines...)
+}
+
+// Drops detections inside exclude zones and, when include zones exist,
+// detections outside all of them.
+func (zs *ZoneSet) Filter(detections []Entity, width, height int) []Entity {
+	zs.mu.RLock()
+	defer zs.mu.RUnlock()
+
+	hasInclude := false
+	for _, zone := range zs.zones {
+		if zone.Type == config.ZoneInclude {
+			hasInclude = true
+			break
+		}
+	}
+
+	filtered := []Entity{}
+	for _, det := range detections {
+		anchor := entityAnchor(det, width, height)
+		included, excluded := !hasInclude, false
+		for _, zone := range zs.zones {
+			if !pointInPolygon(anchor, zone.Points) {
+				continue
+			}
+			switch zone.Type {
+			case config.ZoneInclude:
+				included = true
+			case config.ZoneExclude:
+				excluded = true
+			}
+		}
+
+		if included && !excluded {
+			filtered = append(filtered, det)
+		}
+	}
+
+	return filtered
+}
+
+// Tags tracked entities with the zones they are in and reports the zones
+// they entered or left and the lines they crossed since the last update.
+func (zs *ZoneSet) Update(active, disappeared []Entity, width, height int, now time.Time) ([]Entity, []Event) {
+	zs.mu.Lock()
+	defer zs.mu.Unlock()
+
+	events := []Event{}
+	tagged := make([]Entity, len(active))
+	for i, entity := range active {
+		anchor := entityAnchor(entity, width, height)
+		previous, known := zs.tracks[entity.TrackID]
+
+		inside := make(map[string]bool)
+		entity.Zones = []string{}
+		for _, zone := range zs.zones {
+			if pointInPolygon(anchor, zone.Points) {
+				inside[zone.Name] = true
+				entity.Zones = append(entity.Zones, zone.Name)
+			}
+		}
+		tagged[i] = entity
+
+		for _, zone := range zs.zones {
+			if inside[zone.Name] && !previous.zones[zone.Name] {
+				events = append(events, Event{Type: EventZoneEntered, Entity: &tagged[i], Zone: zone.Name, Timestamp: now})
+			} else if !inside[zone.Name] && previous.zones[zone.Name] {
+				events = append(events, Event{Type: EventZoneExited, Entity: &tagged[i], Zone: zone.Name, Timestamp: now})
+			}
+		}
+
+		if known {
+			for _, line := range zs.lines {
+				if direction, ok := crossesLine(line, previous.anchor, anchor); ok {
+					events = append(events, Event{Type: EventLineCrossed, Entity: &tagged[i], Line: line.Name, Direction: direction, Timestamp: now})
+				}
+			}
+		}
+
+		zs.tracks[entity.TrackID] = zoneTrackState{zones: inside, anchor: anchor}
+	}
+
+	for i, entity := range disappeared {
+		previous, known := zs.tracks[entity.TrackID]
+		if !known {
+			continue
+		}
+		delete(zs.tracks, entity.TrackID)
+
+		for _, zone := range zs.zones {
+			if previous.zones[zone.Name] {
+				events = append(events, Event{Type: EventZoneExited, Entity: &disappeared[i], Zone: zone.Name, Timestamp: now})
+			}
+		}
+	}
+
+	return tagged, events
+}
+
+func (zs *ZoneSet) draw(mat *gocv.Mat, width, height int, modeConfig config.CameraModeConfig) {
+	zs.mu.RLock()
+	defer zs.mu.RUnlock()
+
+	toFrame := func(p [2]float64) image.Point {
+		return mapPoint(image.Pt(int(p[0]*float64(width)), int(p[1]*float64(height))), width, height, modeConfig)
+	}
+
+	for _, zone := range zs.zones {
+		points := make([]image.Point, len(zone.Points))
+		for i, p := range zone.Points {
+			points[i] = toFrame(p)
+		}
+
+		polygon := gocv.NewPointsVectorFromPoints([][]image.Point{points})
+		gocv.Polylines(mat, polygon, true, zoneColors[zone.Type], 2)
+		polygon.Close()
+
+		gocv.PutText(mat, zone.Name, points[0], gocv.FontHersheySimplex, 0.5, zoneColors[zone.Type], 1)
+	}
+
+	for _, line := range zs.lines {
+		from, to := toFrame(line.From), toFrame(line.To)
+		gocv.ArrowedLine(mat, from, to, lineColor, 2)
+		gocv.PutText(mat, line.Name, from, gocv.FontHersheySimplex, 0.5, lineColor, 1)
+	}
+}
@@ -0,0 +1,218 @@
+// core/events/events.go
+package events
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"smuggr.xyz/gatecam/common/config"
+	"smuggr.xyz/gatecam/core/cameras"
+)
+
+const (
+	defaultPath          = "events.db"
+	defaultMaxAge        = 30 * 24 * time.Hour
+	defaultMaxCount      = 100000
+	defaultPruneInterval = time.Minute
+)
+
+const (
+	TypeDeviceRequest = "device_request"
+	TypeDeviceError   = "device_error"
+	TypeStreamStarted = "stream_started"
+	TypeStreamEnded   = "stream_ended"
+)
+
+var Config *config.EventsConfig
+var Store *EventStore
+
+type EventStore struct {
+	*BoltStore
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func fromCameraEvent(camEvent cameras.Event) Event {
+	event := Event{
+		Type:      string(camEvent.Type),
+		Camera:    camEvent.Camera,
+		Zone:      camEvent.Zone,
+		Line:      camEvent.Line,
+		Direction: string(camEvent.Direction),
+		Timestamp: camEvent.Timestamp,
+	}
+
+	if entity := camEvent.Entity; entity != nil {
+		rect := entity.Rect
+		firstSeen, lastSeen := entity.FirstSeen, entity.LastSeen
+		event.Label = entity.Label
+		event.Confidence = entity.Confidence
+		event.Rect = &rect
+		event.TrackID = entity.TrackID
+		event.FirstSeen = &firstSeen
+		event.LastSeen = &lastSeen
+	}
+
+	if motion := camEvent.Motion; motion != nil {
+		event.Score = motion.Score
+	}
+
+	return event
+}
+
+func (es *EventStore) recordCamera(sub *cameras.Subscriber[cameras.Event]) {
+	defer es.wg.Done()
+	defer sub.Close()
+
+	// Entities appearing together share one snapshot, it is written once
+	var lastSnapshot *cameras.Snapshot
+	var snapshotName, thumbnailName string
+
+	for {
+		camEvent, ok := sub.Next(es.stop)
+		if !ok {
+			return
+		}
+
+		event := fromCameraEvent(camEvent)
+		if camEvent.Snapshot != nil {
+			if camEvent.Snapshot != lastSnapshot {
+				var err error
+				lastSnapshot = camEvent.Snapshot
+				if snapshotName, thumbnailName, err = saveSnapshot(camEvent.Camera, camEvent.Snapshot); err != nil {
+					fmt.Printf("failed to save snapshot of camera %s: %v\n", camEvent.Camera, err)
+				}
+			}
+			event.Snapshot, event.Thumbnail = snapshotName, thumbnailName
+		}
+
+		if _, err := es.Add(event); err != nil {
+			fmt.Printf("failed to record event of camera %s: %v\n", camEvent.Camera, err)
+		}
+	}
+}
+
+func (es *EventStore) prune(maxAge time.Duration, maxCount int, interval time.Duration) {
+	defer es.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		deleted, unreferenced, err := es.Prune(maxAge, maxCount)
+		if err != nil {
+			fmt.Println(err)
+		} else if len(deleted) > 0 {
+			for _, name := range unreferenced {
+				removeMedia(name)
+			}
+			fmt.Printf("pruned %d events\n", len(deleted))
+		}
+
+		select {
+		case <-es.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Records an event from outside the camera pipeline, a no-op when the store
+// is not initialized.
+func Record(event Event) {
+	if Store == nil {
+		return
+	}
+
+	if _, err := Store.Add(event); err != nil {
+		fmt.Println(err)
+	}
+}
+
+func Query(q Filter) ([]Event, int, error) {
+	if Store == nil {
+		return nil, 0, fmt.Errorf("event store is not initialized")
+	}
+
+	return Store.Query(q)
+}
+
+func AttachClip(camera string, from, to time.Time, clip string) (int, error) {
+	if Store == nil {
+		return 0, nil
+	}
+
+	return Store.SetClip(camera, from, to, clip)
+}
+
+func DetachClip(camera string, from time.Time, clip string) (int, error) {
+	if Store == nil {
+		return 0, nil
+	}
+
+	return Store.ClearClip(camera, from, clip)
+}
+
+func Get(id uint64) (Event, bool, error) {
+	if Store == nil {
+		return Event{}, false, fmt.Errorf("event store is not initialized")
+	}
+
+	return Store.Get(id)
+}
+
+func Initialize() error {
+	fmt.Println("initializing events")
+	Config = &config.Global.Events
+	MediaConfig = &config.Global.Media
+
+	path := Config.Path
+	if path == "" {
+		path = defaultPath
+	}
+	maxAge := Config.MaxAge
+	if maxAge == 0 {
+		maxAge = defaultMaxAge
+	}
+	maxCount := Config.MaxCount
+	if maxCount == 0 {
+		maxCount = defaultMaxCount
+	}
+	pruneInterval := Config.PruneInterval
+	if pruneInterval <= 0 {
+		pruneInterval = defaultPruneInterval
+	}
+
+	store, err := NewBoltStore(path)
+	if err != nil {
+		return err
+	}
+
+	Store = &EventStore{BoltStore: store, stop: make(chan struct{})}
+
+	for _, cam := range cameras.Server.Cameras() {
+		Store.wg.Add(1)
+		go Store.recordCamera(cam.SubscribeEvents())
+	}
+
+	Store.wg.Add(1)
+	go Store.prune(maxAge, maxCount, pruneInterval)
+
+	fmt.Printf("event store opened at %s\n", path)
+
+	return nil
+}
+
+func Close() {
+	if Store == nil {
+		return
+	}
+
+	close(Store.stop)
+	Store.wg.Wait()
+
+	if err := Store.Close(); err != nil {
+		fmt.Printf("error closing event store: %v\n", err)
+	}
+}
@@ -0,0 +1,83 @@
+// core/events/media.go
+package events
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"smuggr.xyz/gatecam/common/config"
+	"smuggr.xyz/gatecam/core/cameras"
+)
+
+const defaultMediaPath = "media"
+
+var MediaConfig *config.MediaConfig
+
+func mediaRoot() string {
+	if MediaConfig == nil || MediaConfig.Path == "" {
+		return defaultMediaPath
+	}
+	return MediaConfig.Path
+}
+
+// Resolves a path stored in an event, paths escaping the media directory
+// are rejected.
+func MediaPath(name string) (string, error) {
+	root := mediaRoot()
+	path := filepath.Join(root, filepath.FromSlash(name))
+	if rel, err := filepath.Rel(root, path); err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("invalid media path: %s", name)
+	}
+	return path, nil
+}
+
+func writeMedia(name string, data []byte) error {
+	path, err := MediaPath(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create media directory: %v", err)
+	}
+
+	// Written under a temporary name so readers never see a partial file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", name, err)
+	}
+	return os.Rename(tmp, path)
+}
+
+func removeMedia(name string) {
+	if name == "" {
+		return
+	}
+
+	path, err := MediaPath(name)
+	if err != nil {
+		return
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("failed to remove %s: %v\n", name, err)
+	}
+}
+
+// Stores the snapshot of a camera event, returning the snapshot and thumbnail
+// names relative to the media directory.
+func saveSnapshot(camName string, snapshot *cameras.Snapshot) (string, string, error) {
+	base := fmt.Sprintf("snapshots/%s/%s/%d", filepath.Base(camName), snapshot.Timestamp.Format("2006-01-02"), snapshot.Timestamp.UnixNano())
+	imageName, thumbnailName := base+".jpg", base+"_thumb.jpg"
+
+	if err := writeMedia(imageName, snapshot.Image); err != nil {
+		return "", "", err
+	}
+	if err := writeMedia(thumbnailName, snapshot.Thumbnail); err != nil {
+		removeMedia(imageName)
+		return "", "", err
+	}
+
+	return imageName, thumbnailName, nil
+}
@@ -0,0 +1,416 @@
+// core/events/store.go
+package events
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var eventsBucket = []byte("events")
+
+// Keys are the event timestamp followed by its id, IDs are assigned in the
+// order events are recorded which is not the order they happened in.
+var timelineBucket = []byte("timeline")
+
+// Counts the events referencing a snapshot, entities appearing together
+// share one and it is only removed with the last of them.
+var mediaBucket = []byte("media")
+
+type Event struct {
+	ID         uint64           `json:"id"`
+	Type       string           `json:"type"`
+	Camera     string           `json:"camera,omitempty"`
+	Device     string           `json:"device,omitempty"`
+	Label      string           `json:"label,omitempty"`
+	Confidence float32          `json:"confidence,omitempty"`
+	Rect       *image.Rectangle `json:"rect,omitempty"` // In source frame coordinates
+	TrackID    uint64           `json:"track_id,omitempty"`
+	Zone       string           `json:"zone,omitempty"`
+	Line       string           `json:"line,omitempty"`
+	Direction  string           `json:"direction,omitempty"`
+	Score      float64          `json:"score,omitempty"`
+	Details    string           `json:"details,omitempty"`
+	Snapshot   string           `json:"snapshot,omitempty"`  // Relative to the media directory
+	Thumbnail  string           `json:"thumbnail,omitempty"` // Relative to the media directory
+	Clip       string           `json:"clip,omitempty"`      // Relative to the recordings directory
+	Timestamp  time.Time        `json:"timestamp"`
+	FirstSeen  *time.Time       `json:"first_seen,omitempty"`
+	LastSeen   *time.Time       `json:"last_seen,omitempty"`
+}
+
+type Filter struct {
+	Camera string
+	Label  string
+	Type   string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+	Offset int
+}
+
+func (q Filter) matches(event Event) bool {
+	if q.Camera != "" && event.Camera != q.Camera {
+		return false
+	}
+	if q.Label != "" && event.Label != q.Label {
+		return false
+	}
+	if q.Type != "" && event.Type != q.Type {
+		return false
+	}
+	if !q.Until.IsZero() && event.Timestamp.After(q.Until) {
+		return false
+	}
+	return true
+}
+
+type BoltStore struct {
+	db *bolt.DB
+}
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event store %s: %v", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		events, err := tx.CreateBucketIfNotExists(eventsBucket)
+		if err != nil {
+			return err
+		}
+		if tx.Bucket(timelineBucket) != nil && tx.Bucket(mediaBucket) != nil {
+			return nil
+		}
+
+		// Stores created before the indexes existed are indexed once
+		tx.DeleteBucket(timelineBucket)
+		tx.DeleteBucket(mediaBucket)
+		timeline, err := tx.CreateBucket(timelineBucket)
+		if err != nil {
+			return err
+		}
+		media, err := tx.CreateBucket(mediaBucket)
+		if err != nil {
+			return err
+		}
+		return events.ForEach(func(key, data []byte) error {
+			var event Event
+			if err := json.Unmarshal(data, &event); err != nil {
+				return err
+			}
+			if err := addMediaRef(media, event.Snapshot); err != nil {
+				return err
+			}
+			return timeline.Put(timelineKey(event.Timestamp, event.ID), nil)
+		})
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create events bucket: %v", err)
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+func eventKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
+
+func timelineKey(timestamp time.Time, id uint64) []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key, uint64(timestamp.UnixNano()))
+	binary.BigEndian.PutUint64(key[8:], id)
+	return key
+}
+
+func addMediaRef(media *bolt.Bucket, name string) error {
+	if name == "" {
+		return nil
+	}
+
+	var count uint64
+	if data := media.Get([]byte(name)); data != nil {
+		count = binary.BigEndian.Uint64(data)
+	}
+	return media.Put([]byte(name), eventKey(count+1))
+}
+
+// Returns true once no event references the snapshot anymore.
+func releaseMediaRef(media *bolt.Bucket, name string) (bool, error) {
+	if name == "" {
+		return false, nil
+	}
+
+	var count uint64
+	if data := media.Get([]byte(name)); data != nil {
+		count = binary.BigEndian.Uint64(data)
+	}
+	if count <= 1 {
+		return true, media.Delete([]byte(name))
+	}
+	return false, media.Put([]byte(name), eventKey(count-1))
+}
+
+// Calls fn for the events that happened within [from, to] newest first, a
+// zero bound is not applied.
+func walkTimeline(tx *bolt.Tx, from, to time.Time, fn func(event Event)) error {
+	events := tx.Bucket(eventsBucket)
+	cursor := tx.Bucket(timelineBucket).Cursor()
+
+	var key []byte
+	if to.IsZero() {
+		key, _ = cursor.Last()
+	} else {
+		// The seek key sorts after every event at to, so the cursor lands
+		// past them or at the end
+		seek := timelineKey(to, ^uint64(0))
+		if key, _ = cursor.Seek(seek); key == nil {
+			key, _ = cursor.Last()
+		} else if bytes.Compare(key, seek) > 0 {
+			key, _ = cursor.Prev()
+		}
+	}
+
+	for ; key != nil; key, _ = cursor.Prev() {
+		if !from.IsZero() && int64(binary.BigEndian.Uint64(key)) < from.UnixNano() {
+			return nil
+		}
+
+		data := events.Get(key[8:])
+		if data == nil {
+			continue
+		}
+		var event Event
+		if err := json.Unmarshal(data, &event); err != nil {
+			return err
+		}
+		fn(event)
+	}
+	return nil
+}
+
+func (s *BoltStore) Add(event Event) (Event, error) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(eventsBucket)
+
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		event.ID = id
+
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Bucket(timelineBucket).Put(timelineKey(event.Timestamp, id), nil); err != nil {
+			return err
+		}
+		if err := addMediaRef(tx.Bucket(mediaBucket), event.Snapshot); err != nil {
+			return err
+		}
+		return bucket.Put(eventKey(id), data)
+	})
+	if err != nil {
+		return event, fmt.Errorf("failed to store event: %v", err)
+	}
+
+	return event, nil
+}
+
+func (s *BoltStore) Get(id uint64) (Event, bool, error) {
+	var event Event
+	found := false
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(eventsBucket).Get(eventKey(id))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &event)
+	})
+	if err != nil {
+		return event, false, fmt.Errorf("failed to get event %d: %v", id, err)
+	}
+
+	return event, found, nil
+}
+
+// Links a clip to the events of a camera within [from, to] that have none
+// yet, returning how many were updated.
+func (s *BoltStore) SetClip(camera string, from, to time.Time, clip string) (int, error) {
+	updated := 0
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(eventsBucket)
+
+		var matched []Event
+		err := walkTimeline(tx, from, to, func(event Event) {
+			if event.Camera == camera && event.Clip == "" {
+				matched = append(matched, event)
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		// Values are only written after the walk, bbolt cursors do not
+		// survive modifications
+		for _, event := range matched {
+			event.Clip = clip
+			data, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(eventKey(event.ID), data); err != nil {
+				return err
+			}
+		}
+		updated = len(matched)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to attach clip %s: %v", clip, err)
+	}
+
+	return updated, nil
+}
+
+// Unlinks a deleted clip from the events of a camera it was attached to, all
+// of them happened after the clip started. Returns how many were updated.
+func (s *BoltStore) ClearClip(camera string, from time.Time, clip string) (int, error) {
+	updated := 0
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(eventsBucket)
+
+		var matched []Event
+		err := walkTimeline(tx, from, time.Time{}, func(event Event) {
+			if event.Camera == camera && event.Clip == clip {
+				matched = append(matched, event)
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, event := range matched {
+			event.Clip = ""
+			data, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(eventKey(event.ID), data); err != nil {
+				return err
+			}
+		}
+		updated = len(matched)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to detach clip %s: %v", clip, err)
+	}
+
+	return updated, nil
+}
+
+// Returns matching events newest first together with the total number of
+// matches.
+func (s *BoltStore) Query(q Filter) ([]Event, int, error) {
+	events := []Event{}
+	total := 0
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return walkTimeline(tx, q.Since, q.Until, func(event Event) {
+			if !q.matches(event) {
+				return
+			}
+
+			if total >= q.Offset && (q.Limit <= 0 || len(events) < q.Limit) {
+				events = append(events, event)
+			}
+			total++
+		})
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query events: %v", err)
+	}
+
+	return events, total, nil
+}
+
+// Deletes events older than maxAge and the oldest events above maxCount,
+// a non-positive limit is not applied. Returns the deleted events and the
+// media files no remaining event references.
+func (s *BoltStore) Prune(maxAge time.Duration, maxCount int) ([]Event, []string, error) {
+	var deleted []Event
+	var unreferenced []string
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(eventsBucket)
+		timeline := tx.Bucket(timelineBucket)
+		excess := bucket.Stats().KeyN - maxCount
+
+		// Oldest first by the time events happened
+		cursor := timeline.Cursor()
+		for key, _ := cursor.First(); key != nil; key, _ = cursor.Next() {
+			data := bucket.Get(key[8:])
+			if data == nil {
+				continue
+			}
+			var event Event
+			if err := json.Unmarshal(data, &event); err != nil {
+				return err
+			}
+
+			if maxCount > 0 && excess > 0 {
+				excess--
+			} else if maxAge <= 0 || time.Since(event.Timestamp) <= maxAge {
+				break
+			}
+			deleted = append(deleted, event)
+		}
+
+		media := tx.Bucket(mediaBucket)
+		for _, event := range deleted {
+			if err := timeline.Delete(timelineKey(event.Timestamp, event.ID)); err != nil {
+				return err
+			}
+			released, err := releaseMediaRef(media, event.Snapshot)
+			if err != nil {
+				return err
+			}
+			if released {
+				unreferenced = append(unreferenced, event.Snapshot, event.Thumbnail)
+			}
+			if err := bucket.Delete(eventKey(event.ID)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to prune events: %v", err)
+	}
+
+	return deleted, unreferenced, nil
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
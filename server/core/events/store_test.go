@@ -0,0 +1,140 @@
+// core/events/store_test.go
+package events
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T) *BoltStore {
+	t.Helper()
+
+	store, err := NewBoltStore(filepath.Join(t.TempDir(), "events.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// Cameras record on their own goroutines, an event can be stored after a
+// newer one of another camera and must still be found by time.
+func TestStoreQueriesByTimestampNotInsertionOrder(t *testing.T) {
+	store := openTestStore(t)
+	base := time.Now().Add(-time.Hour)
+
+	for _, event := range []Event{
+		{Type: "entity_appeared", Camera: "gate", Timestamp: base.Add(10 * time.Second)},
+		{Type: "entity_appeared", Camera: "yard", Timestamp: base.Add(30 * time.Second)},
+		{Type: "entity_appeared", Camera: "gate", Timestamp: base.Add(20 * time.Second)},
+		{Type: "entity_appeared", Camera: "gate", Timestamp: base},
+	} {
+		if _, err := store.Add(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events, total, err := store.Query(Filter{Camera: "gate", Since: base.Add(5 * time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d (total %d)", len(events), total)
+	}
+	if !events[0].Timestamp.After(events[1].Timestamp) {
+		t.Fatal("events are not ordered newest first")
+	}
+
+	events, _, err = store.Query(Filter{Until: base.Add(25 * time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events until the bound, got %d", len(events))
+	}
+
+	updated, err := store.SetClip("gate", base.Add(5*time.Second), base.Add(25*time.Second), "clips/gate.avi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated != 2 {
+		t.Fatalf("expected the clip on 2 events, got %d", updated)
+	}
+
+	cleared, err := store.ClearClip("gate", base.Add(5*time.Second), "clips/gate.avi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cleared != 2 {
+		t.Fatalf("expected the clip cleared from 2 events, got %d", cleared)
+	}
+}
+
+func TestStorePrunesOldestByTimestamp(t *testing.T) {
+	store := openTestStore(t)
+	now := time.Now()
+
+	recent, err := store.Add(Event{Type: "motion_started", Timestamp: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := store.Add(Event{Type: "motion_started", Timestamp: now.Add(-48 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, _, err := store.Prune(24*time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 || deleted[0].ID != old.ID {
+		t.Fatalf("expected only event %d pruned, got %v", old.ID, deleted)
+	}
+
+	if _, ok, _ := store.Get(recent.ID); !ok {
+		t.Fatal("recent event was pruned")
+	}
+	if events, _, _ := store.Query(Filter{}); len(events) != 1 {
+		t.Fatalf("expected 1 event left, got %d", len(events))
+	}
+}
+
+func TestStoreKeepsSharedSnapshotUntilLastEvent(t *testing.T) {
+	store := openTestStore(t)
+	now := time.Now()
+
+	shared := Event{Type: "entity_appeared", Snapshot: "snapshots/gate/1.jpg", Thumbnail: "snapshots/gate/1_thumb.jpg"}
+	shared.Timestamp = now.Add(-2 * time.Hour)
+	if _, err := store.Add(shared); err != nil {
+		t.Fatal(err)
+	}
+	shared.Timestamp = now
+	if _, err := store.Add(shared); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, unreferenced, err := store.Prune(time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 || len(unreferenced) != 0 {
+		t.Fatalf("expected 1 pruned event and no removable media, got %d and %v", len(deleted), unreferenced)
+	}
+
+	_, unreferenced, err = store.Prune(0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unreferenced) != 0 {
+		t.Fatalf("nothing should be pruned within the limits, got %v", unreferenced)
+	}
+
+	deleted, unreferenced, err = store.Prune(time.Nanosecond, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 || len(unreferenced) != 2 {
+		t.Fatalf("expected the snapshot and thumbnail removable with the last event, got %v", unreferenced)
+	}
+}
@@ -0,0 +1,58 @@
+// core/hls/hls.go
+package hls
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"smuggr.xyz/gatecam/common/config"
+	"smuggr.xyz/gatecam/core/cameras"
+)
+
+var Config *config.StreamingConfig
+var Streams = make(map[string]*Stream)
+
+func scratchRoot() string {
+	if Config == nil || Config.Path == "" {
+		return filepath.Join(os.TempDir(), "gatecam-hls")
+	}
+	return Config.Path
+}
+
+func GetStream(cam *cameras.Camera) (*Stream, bool) {
+	stream, ok := Streams[cam.Name]
+	return stream, ok
+}
+
+func Initialize() {
+	fmt.Println("initializing hls")
+	Config = &config.Global.Streaming
+
+	for _, camConfig := range config.Global.Cameras {
+		if !camConfig.HLS.Enabled {
+			continue
+		}
+
+		cam, ok := cameras.Server.GetCamera(camConfig.Name)
+		if !ok {
+			continue
+		}
+
+		dir := filepath.Join(scratchRoot(), filepath.Base(cam.Name))
+		stream, err := NewStream(cam, camConfig, dir, Config.FFmpegPath)
+		if err != nil {
+			fmt.Printf("camera %s runs without HLS: %v\n", cam.Name, err)
+			continue
+		}
+
+		Streams[cam.Name] = stream
+		fmt.Printf("HLS enabled for camera %s\n", cam.Name)
+	}
+}
+
+func Close() {
+	for _, stream := range Streams {
+		stream.Close()
+	}
+}
@@ -0,0 +1,436 @@
+// core/hls/stream.go
+package hls
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"smuggr.xyz/gatecam/common/config"
+	"smuggr.xyz/gatecam/core/cameras"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	defaultSegmentLength = 2 * time.Second
+	defaultWindowSize    = 5
+	defaultCodec         = "libx264"
+	defaultFFmpegPath    = "ffmpeg"
+	defaultFrameRate     = 15
+	defaultIdleTimeout   = 30 * time.Second
+	playlistName         = "index.m3u8"
+	staleFrameAge        = 2 * time.Second
+)
+
+type segment struct {
+	name          string
+	duration      time.Duration
+	discontinuity bool // First segment of a run, its encoder starts new timestamps
+}
+
+// Encodes the jpeg_stream mode of a camera into a sliding window of MPEG-TS
+// segments. Encoding starts with the first playlist request and stops once
+// nobody asked for the playlist for the idle timeout. A run feeds a single
+// ffmpeg process cutting the segments, so timestamps only restart between
+// runs.
+type Stream struct {
+	cam           *cameras.Camera
+	dir           string
+	ffmpegPath    string
+	codec         string
+	frameRate     int
+	segmentLength time.Duration
+	windowSize    int
+	idleTimeout   time.Duration
+	mu            sync.Mutex
+	running       bool
+	lastRequest   time.Time
+	segments      []segment
+	sequence      uint64 // Media sequence of the first listed segment
+	discontinuity uint64 // Discontinuities that left the window
+	ready         chan struct{}
+	done          chan struct{} // Closed once the last run cleaned up its segments
+	stop          chan struct{}
+	wg            sync.WaitGroup
+}
+
+func NewStream(cam *cameras.Camera, camConfig config.CameraConfig, dir, ffmpegPath string) (*Stream, error) {
+	hlsConfig := camConfig.HLS
+	stream := &Stream{
+		cam:           cam,
+		dir:           dir,
+		ffmpegPath:    ffmpegPath,
+		codec:         hlsConfig.Codec,
+		frameRate:     hlsConfig.FrameRate,
+		segmentLength: hlsConfig.SegmentLength,
+		windowSize:    hlsConfig.WindowSize,
+		idleTimeout:   hlsConfig.IdleTimeout,
+		stop:          make(chan struct{}),
+	}
+
+	if stream.ffmpegPath == "" {
+		stream.ffmpegPath = defaultFFmpegPath
+	}
+	if stream.codec == "" {
+		stream.codec = defaultCodec
+	}
+	if stream.frameRate <= 0 {
+		stream.frameRate = camConfig.FrameRate
+	}
+	if stream.frameRate <= 0 {
+		stream.frameRate = defaultFrameRate
+	}
+	if stream.segmentLength <= 0 {
+		stream.segmentLength = defaultSegmentLength
+	}
+	if stream.windowSize <= 0 {
+		stream.windowSize = defaultWindowSize
+	}
+	if stream.idleTimeout <= 0 {
+		stream.idleTimeout = defaultIdleTimeout
+	}
+
+	if err := stream.checkCodec(); err != nil {
+		return nil, err
+	}
+
+	return stream, nil
+}
+
+// Encodes a single generated frame, a missing ffmpeg or encoder would
+// otherwise only show up as a playlist that never gets segments.
+func (s *Stream) checkCodec() error {
+	cmd := exec.Command(s.ffmpegPath,
+		"-hide_banner", "-loglevel", "error",
+		"-f", "lavfi", "-i", "color=size=64x64:rate=1",
+		"-frames:v", "1", "-c:v", s.codec,
+		"-f", "null", "-",
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("ffmpeg cannot encode with %s: %v %s", s.codec, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Marks the stream as watched and starts encoding if needed, returns a channel
+// closed once the first segment is available.
+func (s *Stream) touch() chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastRequest = time.Now()
+	if !s.running {
+		s.running = true
+		s.ready = make(chan struct{})
+		prev := s.done
+		s.done = make(chan struct{})
+		s.wg.Add(1)
+		go s.run(s.ready, prev, s.done)
+	}
+	return s.ready
+}
+
+func (s *Stream) Playlist(timeout time.Duration) ([]byte, error) {
+	select {
+	case <-s.touch():
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("camera %s has no HLS segments yet", s.cam.Name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var target time.Duration
+	for _, seg := range s.segments {
+		target = max(target, seg.duration)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "#EXTM3U\n")
+	fmt.Fprintf(&buf, "#EXT-X-VERSION:3\n")
+	fmt.Fprintf(&buf, "#EXT-X-TARGETDURATION:%d\n", int(math.Ceil(target.Seconds())))
+	fmt.Fprintf(&buf, "#EXT-X-MEDIA-SEQUENCE:%d\n", s.sequence)
+	fmt.Fprintf(&buf, "#EXT-X-DISCONTINUITY-SEQUENCE:%d\n", s.discontinuity)
+	for _, seg := range s.segments {
+		if seg.discontinuity {
+			fmt.Fprintf(&buf, "#EXT-X-DISCONTINUITY\n")
+		}
+		fmt.Fprintf(&buf, "#EXTINF:%.3f,\n%s\n", seg.duration.Seconds(), seg.name)
+	}
+	return buf.Bytes(), nil
+}
+
+// Only segments in the current window can be fetched.
+func (s *Stream) SegmentPath(name string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastRequest = time.Now()
+	for _, seg := range s.segments {
+		if seg.name == name {
+			return filepath.Join(s.dir, name), true
+		}
+	}
+	return "", false
+}
+
+// Checked under the same lock as touch, a request arriving after this
+// returned true starts a new run instead of getting the ending one.
+func (s *Stream) stopIfIdle() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Since(s.lastRequest) <= s.idleTimeout {
+		return false
+	}
+	s.running = false
+	return true
+}
+
+func (s *Stream) run(ready, prev, done chan struct{}) {
+	defer s.wg.Done()
+	defer close(done)
+
+	// A run that stopped for being idle may still be removing its segments
+	if prev != nil {
+		select {
+		case <-prev:
+		case <-s.stop:
+			return
+		}
+	}
+	defer s.reset(ready)
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		fmt.Printf("camera %s failed to create HLS directory: %v\n", s.cam.Name, err)
+		return
+	}
+
+	if err := s.encode(ready); err != nil {
+		fmt.Printf("camera %s HLS stopped: %v\n", s.cam.Name, err)
+	}
+}
+
+// Waits for the first fresh frame, its size is kept for the whole run.
+func (s *Stream) firstFrame(ticker *time.Ticker) (gocv.Mat, bool) {
+	for {
+		select {
+		case <-s.stop:
+			return gocv.Mat{}, false
+		case <-ticker.C:
+		}
+
+		if s.stopIfIdle() {
+			fmt.Printf("camera %s HLS stopped, no viewers\n", s.cam.Name)
+			return gocv.Mat{}, false
+		}
+
+		frame := s.cam.LatestFrame()
+		if frame == nil {
+			continue
+		}
+		if time.Since(frame.Timestamp) > staleFrameAge {
+			frame.Release()
+			continue
+		}
+
+		mat := s.cam.Render(frame, config.ModeJPEGStream)
+		frame.Release()
+		return mat, true
+	}
+}
+
+func (s *Stream) encode(ready chan struct{}) error {
+	ticker := time.NewTicker(time.Second / time.Duration(s.frameRate))
+	defer ticker.Stop()
+
+	mat, ok := s.firstFrame(ticker)
+	if !ok {
+		return nil
+	}
+	defer mat.Close()
+	size := image.Pt(mat.Cols(), mat.Rows())
+
+	s.mu.Lock()
+	next := s.sequence + uint64(len(s.segments))
+	s.mu.Unlock()
+
+	length := strconv.FormatFloat(s.segmentLength.Seconds(), 'f', 3, 64)
+	cmd := exec.Command(s.ffmpegPath,
+		"-hide_banner", "-loglevel", "error",
+		"-f", "rawvideo", "-pix_fmt", "bgr24",
+		"-s", fmt.Sprintf("%dx%d", size.X, size.Y),
+		"-r", strconv.Itoa(s.frameRate),
+		"-i", "pipe:0",
+		"-c:v", s.codec, "-pix_fmt", "yuv420p",
+		"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%s)", length), // Segments can only be cut on keyframes
+		"-f", "segment", "-segment_format", "mpegts",
+		"-segment_time", length,
+		"-segment_start_number", strconv.FormatUint(next, 10),
+		"-segment_list", "pipe:1", "-segment_list_type", "csv",
+		filepath.Join(s.dir, "segment_%d.ts"),
+	)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %v", err)
+	}
+
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- s.readSegments(stdout, ready)
+	}()
+
+	// A write to a stalled ffmpeg only returns once the process is gone
+	exited := make(chan struct{})
+	go func() {
+		select {
+		case <-s.stop:
+			cmd.Process.Kill()
+		case <-exited:
+		}
+	}()
+
+	// Wait closes stdout, so it only runs after the reader is done with it
+	readDone := false
+	defer func() {
+		stdin.Close()
+		cmd.Process.Kill()
+		if !readDone {
+			<-readErr
+		}
+		close(exited)
+		cmd.Wait()
+	}()
+
+	for {
+		if mat.Cols() != size.X || mat.Rows() != size.Y {
+			gocv.Resize(mat, &mat, size, 0, 0, gocv.InterpolationLinear)
+		}
+		if _, err := stdin.Write(mat.ToBytes()); err != nil {
+			select {
+			case <-s.stop:
+				return nil
+			default:
+			}
+			return fmt.Errorf("failed to feed ffmpeg: %v", err)
+		}
+
+		select {
+		case <-s.stop:
+			return nil
+		case err := <-readErr:
+			readDone = true
+			return err
+		case <-ticker.C:
+		}
+
+		if s.stopIfIdle() {
+			fmt.Printf("camera %s HLS stopped, no viewers\n", s.cam.Name)
+			return nil
+		}
+
+		// A stalled source repeats its last frame to keep the timing
+		if frame := s.cam.LatestFrame(); frame != nil {
+			mat.Close()
+			mat = s.cam.Render(frame, config.ModeJPEGStream)
+			frame.Release()
+		}
+	}
+}
+
+// Publishes the segments ffmpeg lists once they are complete, each line is
+// the file name followed by its start and end time.
+func (s *Stream) readSegments(stdout io.Reader, ready chan struct{}) error {
+	first := true
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ",")
+		if len(fields) < 3 {
+			continue
+		}
+		start, err := strconv.ParseFloat(fields[len(fields)-2], 64)
+		if err != nil {
+			continue
+		}
+		end, err := strconv.ParseFloat(fields[len(fields)-1], 64)
+		if err != nil {
+			continue
+		}
+
+		s.publish(segment{
+			name:          filepath.Base(strings.Join(fields[:len(fields)-2], ",")),
+			duration:      time.Duration((end - start) * float64(time.Second)),
+			discontinuity: first,
+		}, ready)
+		first = false
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read ffmpeg output: %v", err)
+	}
+	return fmt.Errorf("ffmpeg exited")
+}
+
+// Adds a finished segment to the window and deletes the ones sliding out.
+func (s *Stream) publish(seg segment, ready chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.segments) == 0 {
+		close(ready)
+	}
+
+	s.segments = append(s.segments, seg)
+	for len(s.segments) > s.windowSize {
+		s.drop(s.segments[0])
+		s.segments = s.segments[1:]
+	}
+}
+
+// Players resuming later must not see stale segments, the media sequence
+// keeps counting so they notice the discontinuity.
+func (s *Stream) reset(ready chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, seg := range s.segments {
+		s.drop(seg)
+	}
+	s.segments = nil
+	if s.ready == ready {
+		s.running = false
+	}
+}
+
+// Called with the lock held for a segment leaving the window.
+func (s *Stream) drop(seg segment) {
+	os.Remove(filepath.Join(s.dir, seg.name))
+	s.sequence++
+	if seg.discontinuity {
+		s.discontinuity++
+	}
+}
+
+func (s *Stream) Close() {
+	close(s.stop)
+	s.wg.Wait()
+	os.RemoveAll(s.dir)
+}
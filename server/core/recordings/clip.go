@@ -0,0 +1,221 @@
+// core/recordings/clip.go
+package recordings
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"smuggr.xyz/gatecam/common/config"
+	"smuggr.xyz/gatecam/core/cameras"
+	"smuggr.xyz/gatecam/core/events"
+)
+
+const (
+	defaultClipPostRoll  = 10 * time.Second
+	defaultClipMaxLength = 5 * time.Minute
+)
+
+var defaultClipTriggers = []cameras.EventType{
+	cameras.EventEntityAppeared,
+	cameras.EventZoneEntered,
+	cameras.EventLineCrossed,
+	cameras.EventMotionStarted,
+}
+
+// Records clips around camera events, starting with the buffered pre-roll.
+// Events arriving while a clip is recorded extend it instead of starting a
+// new one.
+type ClipRecorder struct {
+	cam         *cameras.Camera
+	triggers    map[cameras.EventType]bool
+	postRoll    time.Duration
+	maxLength   time.Duration
+	frameRate   int
+	stop        chan struct{}
+	wg          sync.WaitGroup
+	out         segmentWriter
+	lastSeq     uint64
+	retryAt     time.Time
+	triggeredAt time.Time
+	triggeredMu sync.Mutex
+}
+
+func NewClipRecorder(cam *cameras.Camera, camConfig config.CameraConfig) (*ClipRecorder, error) {
+	clipConfig := camConfig.Recording.Clips
+
+	format, err := recordingFormat(camConfig.Recording)
+	if err != nil {
+		return nil, err
+	}
+
+	triggers := make(map[cameras.EventType]bool)
+	for _, trigger := range clipConfig.Triggers {
+		triggers[cameras.EventType(trigger)] = true
+	}
+	if len(triggers) == 0 {
+		for _, trigger := range defaultClipTriggers {
+			triggers[trigger] = true
+		}
+	}
+
+	cr := &ClipRecorder{
+		cam:       cam,
+		triggers:  triggers,
+		postRoll:  clipConfig.PostRoll,
+		maxLength: clipConfig.MaxLength,
+		frameRate: cameras.RecordingFrameRate(camConfig),
+		stop:      make(chan struct{}),
+	}
+	cr.out = segmentWriter{camera: cam.Name, kind: KindClip, dir: "clips", format: format, frameRate: cr.frameRate}
+
+	if cr.postRoll <= 0 {
+		cr.postRoll = defaultClipPostRoll
+	}
+	if cr.maxLength <= 0 {
+		cr.maxLength = defaultClipMaxLength
+	}
+
+	return cr, nil
+}
+
+func (cr *ClipRecorder) watchEvents(sub *cameras.Subscriber[cameras.Event]) {
+	defer cr.wg.Done()
+	defer sub.Close()
+
+	for {
+		event, ok := sub.Next(cr.stop)
+		if !ok {
+			return
+		}
+
+		if cr.triggers[event.Type] {
+			cr.triggeredMu.Lock()
+			cr.triggeredAt = event.Timestamp
+			cr.triggeredMu.Unlock()
+		}
+	}
+}
+
+// Motion keeps a clip going while it lasts when motion is one of the triggers.
+func (cr *ClipRecorder) lastActivity(now time.Time) time.Time {
+	if cr.triggers[cameras.EventMotionStarted] {
+		if motion, ok := cr.cam.Motion(); ok && motion.Active {
+			return now
+		}
+	}
+
+	cr.triggeredMu.Lock()
+	defer cr.triggeredMu.Unlock()
+	return cr.triggeredAt
+}
+
+func (cr *ClipRecorder) run() {
+	defer cr.wg.Done()
+
+	ticker := time.NewTicker(time.Second / time.Duration(cr.frameRate))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cr.stop:
+			cr.finishClip()
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		activity := cr.lastActivity(now)
+		active := !activity.IsZero() && now.Sub(activity) <= cr.postRoll
+
+		if cr.out.isOpen() && (!active || now.Sub(cr.out.segment.Start) >= cr.maxLength) {
+			cr.finishClip()
+		}
+		if !active {
+			continue
+		}
+
+		if !cr.out.isOpen() {
+			if now.Before(cr.retryAt) {
+				continue
+			}
+			cr.startClip(now)
+			continue
+		}
+
+		frame := cr.cam.LatestFrame()
+		if frame == nil {
+			continue
+		}
+		if frame.Seq > cr.lastSeq && now.Sub(frame.Timestamp) <= staleFrameAge {
+			cr.writeFrame(frame, now)
+		}
+		frame.Release()
+	}
+}
+
+func (cr *ClipRecorder) startClip(now time.Time) {
+	frames := cr.cam.PreRoll()
+	defer func() {
+		for _, frame := range frames {
+			frame.Release()
+		}
+	}()
+
+	// Frames already part of the previous clip are not repeated
+	for len(frames) > 0 && frames[0].Seq <= cr.lastSeq {
+		frames[0].Release()
+		frames = frames[1:]
+	}
+	if len(frames) == 0 {
+		return
+	}
+
+	first := frames[0]
+	if err := cr.out.open(first.Mat.Cols(), first.Mat.Rows(), first.Timestamp); err != nil {
+		fmt.Printf("camera %s failed to start clip: %v\n", cr.cam.Name, err)
+		cr.retryAt = now.Add(writerRetryDelay)
+		return
+	}
+
+	for _, frame := range frames {
+		cr.writeFrame(frame, frame.Timestamp)
+	}
+}
+
+func (cr *ClipRecorder) writeFrame(frame *cameras.Frame, at time.Time) {
+	// The writer's size is fixed, frames of another size are dropped
+	if frame.Mat.Cols() != cr.out.segment.Width || frame.Mat.Rows() != cr.out.segment.Height {
+		return
+	}
+
+	if err := cr.out.write(frame.Mat, at); err != nil {
+		fmt.Printf("camera %s failed to write clip: %v\n", cr.cam.Name, err)
+		return
+	}
+	cr.lastSeq = frame.Seq
+}
+
+// Finalizes the clip and links it to every event of the camera it covers.
+func (cr *ClipRecorder) finishClip() {
+	clip, ok := cr.out.close()
+	if !ok {
+		return
+	}
+
+	if _, err := events.AttachClip(clip.Camera, clip.Start, clip.End, clip.Path); err != nil {
+		fmt.Println(err)
+	}
+	fmt.Printf("camera %s recorded clip %s (%s)\n", cr.cam.Name, clip.Path, clip.Duration().Round(time.Second))
+}
+
+func (cr *ClipRecorder) Start() {
+	cr.wg.Add(2)
+	go cr.watchEvents(cr.cam.SubscribeEvents())
+	go cr.run()
+}
+
+func (cr *ClipRecorder) Stop() {
+	close(cr.stop)
+	cr.wg.Wait()
+}
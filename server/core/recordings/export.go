@@ -0,0 +1,506 @@
+// core/recordings/export.go
+package recordings
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"smuggr.xyz/gatecam/common/config"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	defaultExportTTL       = 24 * time.Hour
+	defaultMaxExport       = time.Hour
+	defaultExportFrameRate = 15
+	maxTimelapseRange      = 31 * 24 * time.Hour
+	exportsDir             = ".exports" // Hidden so it never collides with the directory of a camera
+)
+
+type ExportStatus string
+
+const (
+	ExportPending ExportStatus = "pending"
+	ExportRunning ExportStatus = "running"
+	ExportDone    ExportStatus = "done"
+	ExportFailed  ExportStatus = "failed"
+)
+
+type ExportJob struct {
+	ID        string       `json:"id"`
+	Kind      SegmentKind  `json:"kind"` // "clip" for plain exports or "timelapse"
+	Camera    string       `json:"camera"`
+	From      time.Time    `json:"from"`
+	To        time.Time    `json:"to"`
+	Overlay   bool         `json:"overlay"`
+	Interval  float64      `json:"interval,omitempty"`  // Timelapse only, seconds between sampled frames
+	Recording string       `json:"recording,omitempty"` // Timelapse only, the indexed result
+	Status    ExportStatus `json:"status"`
+	Progress  float64      `json:"progress"` // 0..1
+	Frames    int          `json:"frames"`
+	Size      int64        `json:"size,omitempty"`
+	Error     string       `json:"error,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	path      string
+	name      string // Relative to the recordings directory
+	frameRate float64
+	interval  time.Duration
+	width     int
+	height    int
+}
+
+var exportJobs = make(map[string]*ExportJob)
+var exportsMu sync.Mutex
+
+// Exports decode and encode whole segments, one at a time keeps them from
+// starving the live pipeline.
+var exportSlot = make(chan struct{}, 1)
+
+func exportTTL() time.Duration {
+	if Config == nil || Config.ExportTTL <= 0 {
+		return defaultExportTTL
+	}
+	return Config.ExportTTL
+}
+
+func maxExport() time.Duration {
+	if Config == nil || Config.MaxExport <= 0 {
+		return defaultMaxExport
+	}
+	return Config.MaxExport
+}
+
+func newExportID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// Starts exporting [from, to] of a camera into one file, the returned job is
+// a copy that can be polled with GetExport.
+func StartExport(camera string, from, to time.Time, overlay bool) (ExportJob, error) {
+	if to.Sub(from) > maxExport() {
+		return ExportJob{}, fmt.Errorf("exports are limited to %s", maxExport())
+	}
+
+	job := &ExportJob{Kind: KindClip, Camera: camera, From: from, To: to, Overlay: overlay}
+	return startJob(job)
+}
+
+// Starts building a timelapse of stored recordings with one frame every
+// interval. Unlike exports the result is kept and listed as a recording.
+func StartTimelapse(camera string, from, to time.Time, interval time.Duration, frameRate int, overlay bool) (ExportJob, error) {
+	if interval <= 0 {
+		return ExportJob{}, fmt.Errorf("interval must be positive")
+	}
+	if to.Sub(from) > maxTimelapseRange {
+		return ExportJob{}, fmt.Errorf("timelapses are limited to %s", maxTimelapseRange)
+	}
+	if frameRate <= 0 {
+		frameRate = defaultTimelapseFrameRate
+	}
+
+	job := &ExportJob{
+		Kind:      KindTimelapse,
+		Camera:    camera,
+		From:      from,
+		To:        to,
+		Overlay:   overlay,
+		Interval:  interval.Seconds(),
+		interval:  interval,
+		frameRate: float64(frameRate),
+	}
+	return startJob(job)
+}
+
+func startJob(job *ExportJob) (ExportJob, error) {
+	if Storage == nil {
+		return ExportJob{}, fmt.Errorf("recordings are not initialized")
+	}
+	if !job.To.After(job.From) {
+		return ExportJob{}, fmt.Errorf("to must be after from")
+	}
+
+	camera, from, to := job.Camera, job.From, job.To
+	segments, err := exportSegments(camera, from, to)
+	if err != nil {
+		return ExportJob{}, err
+	}
+	if len(segments) == 0 {
+		return ExportJob{}, fmt.Errorf("no recordings of camera %s between %s and %s", camera, from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+
+	id, err := newExportID()
+	if err != nil {
+		return ExportJob{}, fmt.Errorf("failed to create export id: %v", err)
+	}
+
+	name := filepath.ToSlash(filepath.Join(exportsDir, id+"."+string(config.RecordingAVI)))
+	if job.Kind == KindTimelapse {
+		name = filepath.ToSlash(filepath.Join(
+			filepath.Base(camera),
+			timelapseDir,
+			from.Format("2006-01-02"),
+			from.Format("15-04-05")+"_"+id[:8]+"."+string(config.RecordingAVI),
+		))
+	}
+
+	path, err := StoragePath(name)
+	if err != nil {
+		return ExportJob{}, err
+	}
+
+	now := time.Now()
+	job.ID = id
+	job.Status = ExportPending
+	job.CreatedAt = now
+	job.ExpiresAt = now.Add(exportTTL())
+	job.path = path
+	job.name = name
+
+	exportsMu.Lock()
+	exportJobs[id] = job
+	exportsMu.Unlock()
+
+	wg.Add(1)
+	go runExport(job, segments)
+
+	return *job, nil
+}
+
+// Continuous segments are used where they cover the range and clips fill
+// the gaps between them. Timelapses are never used as a source.
+func exportSegments(camera string, from, to time.Time) ([]Segment, error) {
+	segments, err := Timeline(camera, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var continuous, clips []Segment
+	for _, seg := range segments {
+		switch seg.Kind {
+		case KindContinuous:
+			continuous = append(continuous, seg)
+		case KindClip:
+			clips = append(clips, seg)
+		}
+	}
+
+	selected := continuous
+	for _, clip := range clips {
+		if coversGap(clip, continuous, from, to) {
+			selected = append(selected, clip)
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].Start.Before(selected[j].Start) })
+
+	return selected, nil
+}
+
+// Whether a segment covers part of [from, to] that none of the segments
+// ordered by start covers.
+func coversGap(seg Segment, covered []Segment, from, to time.Time) bool {
+	start, end := seg.Start, seg.End
+	if start.Before(from) {
+		start = from
+	}
+	if end.After(to) {
+		end = to
+	}
+
+	for _, c := range covered {
+		if !c.End.After(start) {
+			continue
+		}
+		if c.Start.After(start) {
+			break
+		}
+		start = c.End
+	}
+	return start.Before(end)
+}
+
+func updateExport(job *ExportJob, update func(job *ExportJob)) {
+	exportsMu.Lock()
+	defer exportsMu.Unlock()
+	update(job)
+}
+
+func runExport(job *ExportJob, segments []Segment) {
+	defer wg.Done()
+
+	select {
+	case exportSlot <- struct{}{}:
+	case <-stop:
+		updateExport(job, func(job *ExportJob) {
+			job.Status, job.Error = ExportFailed, "server is shutting down"
+		})
+		return
+	}
+	defer func() { <-exportSlot }()
+
+	updateExport(job, func(job *ExportJob) { job.Status = ExportRunning })
+
+	frames, err := writeExport(job, segments)
+	if err != nil {
+		os.Remove(job.path)
+		updateExport(job, func(job *ExportJob) {
+			job.Status, job.Error = ExportFailed, err.Error()
+		})
+		fmt.Printf("export %s of camera %s failed: %v\n", job.ID, job.Camera, err)
+		return
+	}
+
+	var size int64
+	if info, err := os.Stat(job.path); err == nil {
+		size = info.Size()
+	}
+
+	var recording string
+	if job.Kind == KindTimelapse {
+		if recording, err = indexTimelapse(job, frames, size); err != nil {
+			os.Remove(job.path)
+			updateExport(job, func(job *ExportJob) {
+				job.Status, job.Error = ExportFailed, err.Error()
+			})
+			fmt.Println(err)
+			return
+		}
+	}
+
+	updateExport(job, func(job *ExportJob) {
+		job.Status, job.Progress, job.Frames, job.Size, job.Recording = ExportDone, 1, frames, size, recording
+	})
+	fmt.Printf("export %s of camera %s done, %d frames\n", job.ID, job.Camera, frames)
+}
+
+func segmentFrameRate(seg Segment) float64 {
+	if seg.Frames < 2 || seg.Duration() <= 0 {
+		return float64(defaultExportFrameRate)
+	}
+	return float64(seg.Frames-1) / seg.Duration().Seconds()
+}
+
+func indexTimelapse(job *ExportJob, frames int, size int64) (string, error) {
+	seg := Segment{
+		Camera: job.Camera,
+		Kind:   KindTimelapse,
+		Path:   job.name,
+		Start:  job.From,
+		End:    job.To,
+		Size:   size,
+		Frames: frames,
+		Width:  job.width,
+		Height: job.height,
+	}
+	if err := Storage.Add(seg); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(seg.key()), nil
+}
+
+type exportRun struct {
+	job        *ExportJob
+	writer     *gocv.VideoWriter
+	size       image.Point
+	nextSample time.Time // Timelapse only
+	lastFrame  time.Time // Overlapping segments continue after the last written frame
+}
+
+func writeExport(job *ExportJob, segments []Segment) (int, error) {
+	if err := os.MkdirAll(filepath.Dir(job.path), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create export directory: %v", err)
+	}
+
+	first := segments[0]
+	frameRate := job.frameRate
+	if frameRate <= 0 {
+		frameRate = segmentFrameRate(first)
+	}
+	updateExport(job, func(job *ExportJob) { job.width, job.height = first.Width, first.Height })
+
+	writer, err := gocv.VideoWriterFile(job.path, recordingCodecs[config.RecordingAVI], frameRate, first.Width, first.Height, true)
+	if err != nil {
+		return 0, err
+	}
+	defer writer.Close()
+	if !writer.IsOpened() {
+		return 0, fmt.Errorf("failed to open export for writing")
+	}
+
+	run := &exportRun{job: job, writer: writer, size: image.Pt(first.Width, first.Height), nextSample: job.From}
+	total := job.To.Sub(job.From)
+	frames := 0
+	for _, seg := range segments {
+		written, err := run.exportSegment(seg)
+		if err != nil {
+			return frames, err
+		}
+		frames += written
+
+		done := seg.End.Sub(job.From)
+		updateExport(job, func(job *ExportJob) {
+			job.Progress = min(1, max(0, done.Seconds()/total.Seconds()))
+			job.Frames = frames
+		})
+	}
+
+	if frames == 0 {
+		return 0, fmt.Errorf("no frames in the requested range")
+	}
+	return frames, nil
+}
+
+// Frames were written at a fixed rate, so their time is interpolated between
+// the start and end of the segment. Timelapses seek from sample to sample
+// instead of decoding every frame.
+func (run *exportRun) exportSegment(seg Segment) (int, error) {
+	job := run.job
+
+	path, err := StoragePath(seg.Path)
+	if err != nil {
+		return 0, err
+	}
+
+	capture, err := gocv.VideoCaptureFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open recording %s: %v", seg.Path, err)
+	}
+	defer capture.Close()
+
+	var step time.Duration
+	if seg.Frames > 1 {
+		step = seg.Duration() / time.Duration(seg.Frames-1)
+	}
+
+	seek := func(at time.Time) {
+		if skip := at.Sub(seg.Start); skip > 0 && step > 0 {
+			capture.Set(gocv.VideoCapturePosFrames, math.Ceil(float64(skip)/float64(step)))
+		}
+	}
+	if run.lastFrame.After(run.nextSample) {
+		seek(run.lastFrame)
+	} else {
+		seek(run.nextSample)
+	}
+
+	mat := gocv.NewMat()
+	defer mat.Close()
+
+	written := 0
+	for {
+		select {
+		case <-stop:
+			return written, fmt.Errorf("server is shutting down")
+		default:
+		}
+
+		at := seg.Start.Add(time.Duration(capture.Get(gocv.VideoCapturePosFrames)) * step)
+		if ok := capture.Read(&mat); !ok || mat.Empty() {
+			return written, nil
+		}
+
+		if at.Before(run.nextSample) || (!run.lastFrame.IsZero() && !at.After(run.lastFrame)) {
+			continue
+		}
+		if at.After(job.To) {
+			return written, nil
+		}
+
+		if mat.Cols() != run.size.X || mat.Rows() != run.size.Y {
+			gocv.Resize(mat, &mat, run.size, 0, 0, gocv.InterpolationLinear)
+		}
+		if job.Overlay {
+			drawExportOverlay(&mat, job.Camera, at)
+		}
+
+		if err := run.writer.Write(mat); err != nil {
+			return written, fmt.Errorf("failed to write export: %v", err)
+		}
+		written++
+		run.lastFrame = at
+
+		if job.interval > 0 {
+			for !run.nextSample.After(at) {
+				run.nextSample = run.nextSample.Add(job.interval)
+			}
+			seek(run.nextSample)
+		}
+	}
+}
+
+func drawExportOverlay(mat *gocv.Mat, camera string, at time.Time) {
+	text := fmt.Sprintf("%s %s", camera, at.Format("2006-01-02 15:04:05"))
+	scale := float64(mat.Cols()) / 1280
+	if scale < 0.35 {
+		scale = 0.35
+	}
+
+	size := gocv.GetTextSize(text, gocv.FontHersheySimplex, scale, 1)
+	origin := image.Pt(8, mat.Rows()-8)
+	gocv.Rectangle(mat, image.Rect(0, mat.Rows()-size.Y-16, size.X+16, mat.Rows()), color.RGBA{0, 0, 0, 0}, -1)
+	gocv.PutText(mat, text, origin, gocv.FontHersheySimplex, scale, color.RGBA{255, 255, 255, 0}, 1)
+}
+
+func GetExport(camera, id string) (ExportJob, bool) {
+	exportsMu.Lock()
+	defer exportsMu.Unlock()
+
+	job, ok := exportJobs[id]
+	if !ok || job.Camera != camera || time.Now().After(job.ExpiresAt) {
+		return ExportJob{}, false
+	}
+	return *job, true
+}
+
+func OpenExport(camera, id string) (*os.File, ExportJob, error) {
+	job, ok := GetExport(camera, id)
+	if !ok {
+		return nil, job, fmt.Errorf("export not found: %s", id)
+	}
+	if job.Status != ExportDone {
+		return nil, job, fmt.Errorf("export %s is %s", id, job.Status)
+	}
+
+	file, err := os.Open(job.path)
+	return file, job, err
+}
+
+func expireExports() {
+	exportsMu.Lock()
+	defer exportsMu.Unlock()
+
+	now := time.Now()
+	for id, job := range exportJobs {
+		if now.After(job.ExpiresAt) && job.Status != ExportRunning && job.Status != ExportPending {
+			// Timelapses stay as recordings after their job is gone
+			if job.Kind != KindTimelapse {
+				os.Remove(job.path)
+			}
+			delete(exportJobs, id)
+		}
+	}
+}
+
+// Exports are not indexed, files left over from a previous run are removed
+// on startup.
+func cleanExports() {
+	dir, err := StoragePath(exportsDir)
+	if err != nil {
+		return
+	}
+	os.RemoveAll(dir)
+}
@@ -0,0 +1,36 @@
+// core/recordings/export_test.go
+package recordings
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCoversGap(t *testing.T) {
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+	span := func(from, to int) Segment { return Segment{Start: at(from), End: at(to)} }
+
+	continuous := []Segment{span(0, 10), span(20, 30)}
+	for _, tc := range []struct {
+		name string
+		clip Segment
+		want bool
+	}{
+		{"inside continuous", span(2, 8), false},
+		{"spanning a boundary", span(8, 12), true},
+		{"inside a gap", span(12, 18), true},
+		{"covering the joint of two segments", span(5, 25), true},
+		{"gap outside the range", span(30, 40), false},
+		{"before the first segment", span(-5, 1), false},
+	} {
+		if got := coversGap(tc.clip, continuous, at(0), at(30)); got != tc.want {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+
+	adjacent := []Segment{span(0, 10), span(10, 30)}
+	if coversGap(span(5, 15), adjacent, at(0), at(30)) {
+		t.Error("adjacent segments leave no gap")
+	}
+}
@@ -0,0 +1,212 @@
+// core/recordings/index.go
+package recordings
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var segmentsBucket = []byte("segments")
+
+type SegmentKind string
+
+const (
+	KindContinuous SegmentKind = "continuous"
+	KindClip       SegmentKind = "clip"
+	KindTimelapse  SegmentKind = "timelapse"
+)
+
+type Segment struct {
+	ID     string      `json:"id"` // Derived from the index key, not stored
+	Camera string      `json:"camera"`
+	Kind   SegmentKind `json:"kind"`
+	Path   string      `json:"path"` // Relative to the recordings directory
+	Start  time.Time   `json:"start"`
+	End    time.Time   `json:"end"`
+	Size   int64       `json:"size"`
+	Frames int         `json:"frames"`
+	Width  int         `json:"width"`
+	Height int         `json:"height"`
+}
+
+func (seg Segment) Duration() time.Duration {
+	return seg.End.Sub(seg.Start)
+}
+
+// Keys sort by start time first so the oldest segments of all cameras come
+// first when walking the bucket.
+func (seg Segment) key() []byte {
+	key := make([]byte, 8, 8+len(seg.Camera)+len(seg.Kind)+2)
+	binary.BigEndian.PutUint64(key, uint64(seg.Start.UnixNano()))
+	key = append(key, seg.Camera...)
+	key = append(key, 0)
+	key = append(key, seg.Kind...)
+	return key
+}
+
+func decodeSegment(key, data []byte) (Segment, error) {
+	var seg Segment
+	if err := json.Unmarshal(data, &seg); err != nil {
+		return seg, err
+	}
+	seg.ID = hex.EncodeToString(key)
+	return seg, nil
+}
+
+type Index struct {
+	db *bolt.DB
+}
+
+func NewIndex(path string) (*Index, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recordings index %s: %v", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(segmentsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create segments bucket: %v", err)
+	}
+
+	return &Index{db: db}, nil
+}
+
+func (idx *Index) Add(seg Segment) error {
+	seg.ID = ""
+	data, err := json.Marshal(seg)
+	if err != nil {
+		return err
+	}
+
+	err = idx.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(segmentsBucket).Put(seg.key(), data)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to index segment %s: %v", seg.Path, err)
+	}
+
+	return nil
+}
+
+// Segments of a camera overlapping [from, to] ordered by start, zero times
+// leave the range open.
+func (idx *Index) List(camera string, from, to time.Time) ([]Segment, error) {
+	segments := []Segment{}
+
+	err := idx.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(segmentsBucket).Cursor()
+		for key, data := cursor.First(); key != nil; key, data = cursor.Next() {
+			if !to.IsZero() && int64(binary.BigEndian.Uint64(key[:8])) > to.UnixNano() {
+				break
+			}
+			if camera != "" && !bytes.HasPrefix(key[8:], append([]byte(camera), 0)) {
+				continue
+			}
+
+			seg, err := decodeSegment(key, data)
+			if err != nil {
+				return err
+			}
+			if !from.IsZero() && seg.End.Before(from) {
+				continue
+			}
+			segments = append(segments, seg)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list segments: %v", err)
+	}
+
+	return segments, nil
+}
+
+func (idx *Index) Get(id string) (Segment, bool, error) {
+	key, err := hex.DecodeString(id)
+	if err != nil || len(key) <= 8 {
+		return Segment{}, false, nil
+	}
+
+	var seg Segment
+	found := false
+	err = idx.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(segmentsBucket).Get(key)
+		if data == nil {
+			return nil
+		}
+		found = true
+		seg, err = decodeSegment(key, data)
+		return err
+	})
+	if err != nil {
+		return Segment{}, false, fmt.Errorf("failed to get segment %s: %v", id, err)
+	}
+
+	return seg, found, nil
+}
+
+func (idx *Index) Delete(seg Segment) error {
+	return idx.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(segmentsBucket).Delete(seg.key())
+	})
+}
+
+// Removes the oldest segments until none is older than maxAge and the total
+// size fits maxBytes, a non-positive limit is not applied. Returns the removed
+// segments so their files can be deleted.
+func (idx *Index) Prune(maxAge time.Duration, maxBytes int64) ([]Segment, error) {
+	var deleted []Segment
+
+	err := idx.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(segmentsBucket)
+
+		var segments []Segment
+		var total int64
+		err := bucket.ForEach(func(key, data []byte) error {
+			seg, err := decodeSegment(key, data)
+			if err != nil {
+				return err
+			}
+			segments = append(segments, seg)
+			total += seg.Size
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, seg := range segments {
+			expired := maxAge > 0 && time.Since(seg.End) > maxAge
+			overQuota := maxBytes > 0 && total > maxBytes
+			if !expired && !overQuota {
+				break
+			}
+
+			if err := bucket.Delete(seg.key()); err != nil {
+				return err
+			}
+			total -= seg.Size
+			deleted = append(deleted, seg)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to prune segments: %v", err)
+	}
+
+	return deleted, nil
+}
+
+func (idx *Index) Close() error {
+	return idx.db.Close()
+}
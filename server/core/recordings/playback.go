@@ -0,0 +1,125 @@
+// core/recordings/playback.go
+package recordings
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"smuggr.xyz/gatecam/common/config"
+
+	"gocv.io/x/gocv"
+)
+
+var contentTypes = map[config.RecordingFormat]string{
+	config.RecordingAVI: "video/x-msvideo",
+	config.RecordingMP4: "video/mp4",
+}
+
+func ContentType(seg Segment) string {
+	format := config.RecordingFormat(strings.TrimPrefix(filepath.Ext(seg.Path), "."))
+	if contentType, ok := contentTypes[format]; ok {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+func Timeline(camera string, from, to time.Time) ([]Segment, error) {
+	if Storage == nil {
+		return nil, fmt.Errorf("recordings are not initialized")
+	}
+
+	return Storage.List(camera, from, to)
+}
+
+// Looks up a recording of a camera, recordings of other cameras are not found.
+func Find(camera, id string) (Segment, bool, error) {
+	if Storage == nil {
+		return Segment{}, false, fmt.Errorf("recordings are not initialized")
+	}
+
+	seg, ok, err := Storage.Get(id)
+	if err != nil || !ok || seg.Camera != camera {
+		return Segment{}, false, err
+	}
+	return seg, true, nil
+}
+
+func Open(seg Segment) (*os.File, error) {
+	path, err := StoragePath(seg.Path)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// Continuous segments are preferred over clips when both cover at, timelapses
+// are skipped since their frames are not in real time.
+func segmentAt(camera string, at time.Time) (Segment, bool, error) {
+	segments, err := Timeline(camera, at, at)
+	if err != nil {
+		return Segment{}, false, err
+	}
+
+	var found Segment
+	ok := false
+	for _, seg := range segments {
+		if seg.Kind == KindTimelapse || seg.Start.After(at) || seg.End.Before(at) {
+			continue
+		}
+		if !ok || (found.Kind != KindContinuous && seg.Kind == KindContinuous) {
+			found, ok = seg, true
+		}
+	}
+	return found, ok, nil
+}
+
+// Decodes the recorded frame closest to at as a JPEG.
+func FrameAt(camera string, at time.Time) ([]byte, error) {
+	seg, ok, err := segmentAt(camera, at)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("no recording of camera %s at %s", camera, at.Format(time.RFC3339))
+	}
+
+	path, err := StoragePath(seg.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	capture, err := gocv.VideoCaptureFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording %s: %v", seg.Path, err)
+	}
+	defer capture.Close()
+
+	// Segments hold fewer frames than their writer's rate suggests when frames
+	// were skipped, e.g. clips, so the index is interpolated over the frames
+	// actually written like exports do
+	if seg.Frames > 1 && seg.Duration() > 0 {
+		step := seg.Duration() / time.Duration(seg.Frames-1)
+		index := math.Round(float64(at.Sub(seg.Start)) / float64(step))
+		capture.Set(gocv.VideoCapturePosFrames, max(0, min(index, float64(seg.Frames-1))))
+	}
+
+	mat := gocv.NewMat()
+	defer mat.Close()
+	if ok := capture.Read(&mat); !ok || mat.Empty() {
+		return nil, fmt.Errorf("failed to read frame from recording %s", seg.Path)
+	}
+
+	buf, err := gocv.IMEncode(gocv.JPEGFileExt, mat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode frame: %v", err)
+	}
+	defer buf.Close()
+
+	data := make([]byte, buf.Len())
+	copy(data, buf.GetBytes())
+	return data, nil
+}
@@ -0,0 +1,159 @@
+// core/recordings/recorder.go
+package recordings
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"smuggr.xyz/gatecam/common/config"
+	"smuggr.xyz/gatecam/core/cameras"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	defaultSegmentLength = 5 * time.Minute
+	staleFrameAge        = 2 * time.Second // An older latest frame means the source is down
+	writerRetryDelay     = 5 * time.Second
+)
+
+func recordingFormat(recConfig config.RecordingConfig) (config.RecordingFormat, error) {
+	format := recConfig.Format
+	if format == "" {
+		format = config.RecordingAVI
+	}
+	if _, ok := recordingCodecs[format]; !ok {
+		return "", fmt.Errorf("unsupported recording format: %s", format)
+	}
+	return format, nil
+}
+
+type Recorder struct {
+	cam           *cameras.Camera
+	mode          config.RecordingMode
+	schedule      []scheduleWindow
+	segmentLength time.Duration
+	frameRate     int
+	stop          chan struct{}
+	wg            sync.WaitGroup
+	out           segmentWriter
+	retryAt       time.Time
+}
+
+func NewRecorder(cam *cameras.Camera, camConfig config.CameraConfig) (*Recorder, error) {
+	recConfig := camConfig.Recording
+
+	schedule, err := parseSchedule(recConfig.Schedule)
+	if err != nil {
+		return nil, err
+	}
+	if recConfig.Mode == config.RecordingScheduled && len(schedule) == 0 {
+		return nil, fmt.Errorf("scheduled recording needs at least one schedule window")
+	}
+
+	format, err := recordingFormat(recConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Recorder{
+		cam:           cam,
+		mode:          recConfig.Mode,
+		schedule:      schedule,
+		segmentLength: recConfig.SegmentLength,
+		frameRate:     cameras.RecordingFrameRate(camConfig),
+		stop:          make(chan struct{}),
+	}
+	r.out = segmentWriter{camera: cam.Name, kind: KindContinuous, format: format, frameRate: r.frameRate}
+
+	if r.segmentLength <= 0 {
+		r.segmentLength = defaultSegmentLength
+	}
+
+	return r, nil
+}
+
+func (r *Recorder) recording(now time.Time) bool {
+	switch r.mode {
+	case config.RecordingAlways:
+		return true
+	case config.RecordingScheduled:
+		return scheduled(r.schedule, now)
+	default:
+		return false
+	}
+}
+
+// Frames are sampled from the camera at a fixed rate instead of subscribing,
+// this keeps the file timing right and never holds back the live pipeline.
+func (r *Recorder) run() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(time.Second / time.Duration(r.frameRate))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			r.out.close()
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		if !r.recording(now) {
+			r.out.close()
+			continue
+		}
+
+		frame := r.cam.LatestFrame()
+		if frame == nil {
+			continue
+		}
+
+		if now.Sub(frame.Timestamp) > staleFrameAge {
+			frame.Release()
+			r.out.close()
+			continue
+		}
+
+		r.writeFrame(frame.Mat, now)
+		frame.Release()
+	}
+}
+
+func (r *Recorder) writeFrame(mat gocv.Mat, now time.Time) {
+	if r.out.isOpen() {
+		segment := r.out.segment
+		resized := mat.Cols() != segment.Width || mat.Rows() != segment.Height
+		if resized || now.Sub(segment.Start) >= r.segmentLength {
+			r.out.close()
+		}
+	}
+
+	if !r.out.isOpen() {
+		if now.Before(r.retryAt) {
+			return
+		}
+		if err := r.out.open(mat.Cols(), mat.Rows(), now); err != nil {
+			fmt.Printf("camera %s failed to start recording: %v\n", r.cam.Name, err)
+			r.retryAt = now.Add(writerRetryDelay)
+			return
+		}
+	}
+
+	if err := r.out.write(mat, now); err != nil {
+		fmt.Printf("camera %s failed to write recording: %v\n", r.cam.Name, err)
+	}
+}
+
+func (r *Recorder) Start() {
+	r.wg.Add(1)
+	go r.run()
+}
+
+func (r *Recorder) Stop() {
+	close(r.stop)
+	r.wg.Wait()
+}
@@ -0,0 +1,197 @@
+// core/recordings/recordings.go
+package recordings
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"smuggr.xyz/gatecam/common/config"
+	"smuggr.xyz/gatecam/core/cameras"
+	"smuggr.xyz/gatecam/core/events"
+)
+
+const (
+	defaultPath          = "recordings"
+	defaultMaxAge        = 7 * 24 * time.Hour
+	defaultMaxBytes      = 50 << 30
+	defaultPruneInterval = time.Minute
+	indexFileName        = "index.db"
+)
+
+var Config *config.RecordingsConfig
+var Storage *Index
+var Recorders = make(map[string]*Recorder)
+var ClipRecorders = make(map[string]*ClipRecorder)
+var TimelapseRecorders = make(map[string]*TimelapseRecorder)
+
+var stop chan struct{}
+var wg sync.WaitGroup
+
+func storageRoot() string {
+	if Config == nil || Config.Path == "" {
+		return defaultPath
+	}
+	return Config.Path
+}
+
+// Resolves a path stored in the index, paths escaping the recordings
+// directory are rejected.
+func StoragePath(name string) (string, error) {
+	root := storageRoot()
+	path := filepath.Join(root, filepath.FromSlash(name))
+	if rel, err := filepath.Rel(root, path); err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("invalid recording path: %s", name)
+	}
+	return path, nil
+}
+
+func removeSegment(seg Segment) {
+	path, err := StoragePath(seg.Path)
+	if err != nil {
+		return
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("failed to remove recording %s: %v\n", seg.Path, err)
+	}
+}
+
+func prune(maxAge time.Duration, maxBytes int64, interval time.Duration) {
+	defer wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := Storage.Prune(maxAge, maxBytes)
+		if err != nil {
+			fmt.Println(err)
+		}
+		for _, seg := range deleted {
+			removeSegment(seg)
+			if seg.Kind != KindClip {
+				continue
+			}
+			// Events outlive their clips, they must not link to deleted files
+			if _, err := events.DetachClip(seg.Camera, seg.Start, seg.Path); err != nil {
+				fmt.Println(err)
+			}
+		}
+		if len(deleted) > 0 {
+			fmt.Printf("pruned %d recordings\n", len(deleted))
+		}
+		expireExports()
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func loadRecorders() {
+	for _, camConfig := range config.Global.Cameras {
+		cam, ok := cameras.Server.GetCamera(camConfig.Name)
+		if !ok {
+			continue
+		}
+
+		if recMode := camConfig.Recording.Mode; recMode != "" && recMode != config.RecordingOff {
+			recorder, err := NewRecorder(cam, camConfig)
+			if err != nil {
+				fmt.Printf("camera %s runs without recording: %v\n", camConfig.Name, err)
+			} else {
+				recorder.Start()
+				Recorders[cam.Name] = recorder
+				fmt.Printf("Recording camera %s: %s\n", cam.Name, recMode)
+			}
+		}
+
+		if camConfig.Recording.Clips.Enabled {
+			clipRecorder, err := NewClipRecorder(cam, camConfig)
+			if err != nil {
+				fmt.Printf("camera %s runs without clips: %v\n", camConfig.Name, err)
+			} else {
+				clipRecorder.Start()
+				ClipRecorders[cam.Name] = clipRecorder
+				fmt.Printf("Recording clips of camera %s\n", cam.Name)
+			}
+		}
+
+		if camConfig.Recording.Timelapse.Enabled {
+			timelapseRecorder, err := NewTimelapseRecorder(cam, camConfig)
+			if err != nil {
+				fmt.Printf("camera %s runs without timelapse: %v\n", camConfig.Name, err)
+			} else {
+				timelapseRecorder.Start()
+				TimelapseRecorders[cam.Name] = timelapseRecorder
+				fmt.Printf("Recording timelapse of camera %s\n", cam.Name)
+			}
+		}
+	}
+}
+
+func Initialize() error {
+	fmt.Println("initializing recordings")
+	Config = &config.Global.Recordings
+
+	maxAge := Config.MaxAge
+	if maxAge == 0 {
+		maxAge = defaultMaxAge
+	}
+	maxBytes := Config.MaxBytes
+	if maxBytes == 0 {
+		maxBytes = defaultMaxBytes
+	}
+	pruneInterval := Config.PruneInterval
+	if pruneInterval <= 0 {
+		pruneInterval = defaultPruneInterval
+	}
+
+	if err := os.MkdirAll(storageRoot(), 0755); err != nil {
+		return fmt.Errorf("failed to create recordings directory: %v", err)
+	}
+
+	index, err := NewIndex(filepath.Join(storageRoot(), indexFileName))
+	if err != nil {
+		return err
+	}
+	Storage = index
+	stop = make(chan struct{})
+	cleanExports()
+	recoverOpenSegments()
+
+	loadRecorders()
+
+	wg.Add(1)
+	go prune(maxAge, maxBytes, pruneInterval)
+
+	return nil
+}
+
+func Close() {
+	if Storage == nil {
+		return
+	}
+
+	for _, recorder := range Recorders {
+		recorder.Stop()
+	}
+	for _, clipRecorder := range ClipRecorders {
+		clipRecorder.Stop()
+	}
+	for _, timelapseRecorder := range TimelapseRecorders {
+		timelapseRecorder.Stop()
+	}
+
+	close(stop)
+	wg.Wait()
+
+	if err := Storage.Close(); err != nil {
+		fmt.Printf("error closing recordings index: %v\n", err)
+	}
+}
@@ -0,0 +1,85 @@
+// core/recordings/schedule.go
+package recordings
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"smuggr.xyz/gatecam/common/config"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+type scheduleWindow struct {
+	days  map[time.Weekday]bool // Every day when empty
+	start time.Duration         // Offsets from midnight
+	end   time.Duration
+}
+
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func parseSchedule(windows []config.ScheduleWindow) ([]scheduleWindow, error) {
+	schedule := make([]scheduleWindow, 0, len(windows))
+	for _, window := range windows {
+		start, err := parseClock(window.Start)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClock(window.End)
+		if err != nil {
+			return nil, err
+		}
+
+		days := make(map[time.Weekday]bool)
+		for _, day := range window.Days {
+			weekday, ok := weekdays[strings.ToLower(day)]
+			if !ok {
+				return nil, fmt.Errorf("invalid schedule day: %s", day)
+			}
+			days[weekday] = true
+		}
+
+		schedule = append(schedule, scheduleWindow{days: days, start: start, end: end})
+	}
+
+	return schedule, nil
+}
+
+func (w scheduleWindow) onDay(day time.Weekday) bool {
+	return len(w.days) == 0 || w.days[day]
+}
+
+// Overnight windows belong to the day they start on.
+func (w scheduleWindow) contains(t time.Time) bool {
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if w.start < w.end {
+		return w.onDay(t.Weekday()) && offset >= w.start && offset < w.end
+	}
+
+	previousDay := (t.Weekday() + 6) % 7
+	return (w.onDay(t.Weekday()) && offset >= w.start) || (w.onDay(previousDay) && offset < w.end)
+}
+
+func scheduled(schedule []scheduleWindow, t time.Time) bool {
+	for _, window := range schedule {
+		if window.contains(t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+// core/recordings/timelapse.go
+package recordings
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"smuggr.xyz/gatecam/common/config"
+	"smuggr.xyz/gatecam/core/cameras"
+)
+
+const (
+	defaultTimelapseInterval  = 10 * time.Second
+	defaultTimelapsePeriod    = 24 * time.Hour
+	defaultTimelapseFrameRate = 30
+	timelapseDir              = "timelapse"
+)
+
+// Samples the live pipeline and writes each period into its own timelapse.
+// A period can last a day, so the timelapse is listed with the recordings
+// from its first frame and completed once the period is over.
+type TimelapseRecorder struct {
+	cam      *cameras.Camera
+	interval time.Duration
+	period   time.Duration
+	stop     chan struct{}
+	wg       sync.WaitGroup
+	out      segmentWriter
+	retryAt  time.Time
+}
+
+func NewTimelapseRecorder(cam *cameras.Camera, camConfig config.CameraConfig) (*TimelapseRecorder, error) {
+	tlConfig := camConfig.Recording.Timelapse
+
+	format, err := recordingFormat(camConfig.Recording)
+	if err != nil {
+		return nil, err
+	}
+
+	tr := &TimelapseRecorder{
+		cam:      cam,
+		interval: tlConfig.Interval,
+		period:   tlConfig.Period,
+		stop:     make(chan struct{}),
+	}
+
+	if tr.interval <= 0 {
+		tr.interval = defaultTimelapseInterval
+	}
+	if tr.period <= 0 {
+		tr.period = defaultTimelapsePeriod
+	}
+	if tr.period < tr.interval {
+		return nil, fmt.Errorf("timelapse period %s is shorter than its interval %s", tr.period, tr.interval)
+	}
+
+	frameRate := tlConfig.FrameRate
+	if frameRate <= 0 {
+		frameRate = defaultTimelapseFrameRate
+	}
+	tr.out = segmentWriter{camera: cam.Name, kind: KindTimelapse, dir: timelapseDir, format: format, frameRate: frameRate, indexOpen: true}
+
+	return tr, nil
+}
+
+// Periods are counted from local midnight so daily timelapses cover whole
+// days.
+func (tr *TimelapseRecorder) periodStart(t time.Time) time.Time {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return midnight.Add(t.Sub(midnight) / tr.period * tr.period)
+}
+
+func (tr *TimelapseRecorder) run() {
+	defer tr.wg.Done()
+
+	ticker := time.NewTicker(tr.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-tr.stop:
+			tr.finish()
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		if tr.out.isOpen() && tr.out.segment.Start.Before(tr.periodStart(now)) {
+			tr.finish()
+		}
+
+		frame := tr.cam.LatestFrame()
+		if frame == nil {
+			continue
+		}
+		if now.Sub(frame.Timestamp) <= staleFrameAge {
+			tr.writeFrame(frame, now)
+		}
+		frame.Release()
+	}
+}
+
+// A timelapse starts with its first sample, after a restart the rest of the
+// period goes into a new file instead of replacing the earlier one.
+func (tr *TimelapseRecorder) writeFrame(frame *cameras.Frame, now time.Time) {
+	width, height := frame.Mat.Cols(), frame.Mat.Rows()
+
+	if !tr.out.isOpen() {
+		if now.Before(tr.retryAt) {
+			return
+		}
+		if err := tr.out.open(width, height, now); err != nil {
+			fmt.Printf("camera %s failed to start timelapse: %v\n", tr.cam.Name, err)
+			tr.retryAt = now.Add(writerRetryDelay)
+			return
+		}
+	}
+
+	// A timelapse keeps the size it started with
+	if width != tr.out.segment.Width || height != tr.out.segment.Height {
+		return
+	}
+
+	if err := tr.out.write(frame.Mat, now); err != nil {
+		fmt.Printf("camera %s failed to write timelapse: %v\n", tr.cam.Name, err)
+	}
+}
+
+func (tr *TimelapseRecorder) finish() {
+	if timelapse, ok := tr.out.close(); ok {
+		fmt.Printf("camera %s recorded timelapse %s (%d frames)\n", tr.cam.Name, timelapse.Path, timelapse.Frames)
+	}
+}
+
+func (tr *TimelapseRecorder) Start() {
+	tr.wg.Add(1)
+	go tr.run()
+}
+
+func (tr *TimelapseRecorder) Stop() {
+	close(tr.stop)
+	tr.wg.Wait()
+}
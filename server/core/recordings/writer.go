@@ -0,0 +1,178 @@
+// core/recordings/writer.go
+package recordings
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"smuggr.xyz/gatecam/common/config"
+
+	"gocv.io/x/gocv"
+)
+
+var recordingCodecs = map[config.RecordingFormat]string{
+	config.RecordingAVI: "MJPG",
+	config.RecordingMP4: "mp4v",
+}
+
+// Writes one indexed recording file at a time.
+type segmentWriter struct {
+	camera    string
+	kind      SegmentKind
+	dir       string // Below the camera directory, empty for continuous segments
+	format    config.RecordingFormat
+	frameRate int
+	indexOpen bool // Listed from the start with a size of 0, so a crash never leaves an unindexed file
+	writer    *gocv.VideoWriter
+	segment   Segment
+}
+
+func (w *segmentWriter) isOpen() bool {
+	return w.writer != nil
+}
+
+// Segments can be reopened within a second on a resize, names carry
+// milliseconds and a suffix so an indexed file is never overwritten.
+func (w *segmentWriter) segmentName(start time.Time) (string, string, error) {
+	base := filepath.Join(filepath.Base(w.camera), w.dir, start.Format("2006-01-02"), start.Format("15-04-05.000"))
+	for i := 0; ; i++ {
+		name := base + "." + string(w.format)
+		if i > 0 {
+			name = fmt.Sprintf("%s_%d.%s", base, i, w.format)
+		}
+		name = filepath.ToSlash(name)
+
+		path, err := StoragePath(name)
+		if err != nil {
+			return "", "", err
+		}
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return name, path, nil
+		} else if err != nil {
+			return "", "", fmt.Errorf("failed to check %s: %v", name, err)
+		}
+	}
+}
+
+func (w *segmentWriter) open(width, height int, start time.Time) error {
+	name, path, err := w.segmentName(start)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create recordings directory: %v", err)
+	}
+
+	writer, err := gocv.VideoWriterFile(path, recordingCodecs[w.format], float64(w.frameRate), width, height, true)
+	if err != nil {
+		return err
+	}
+	if !writer.IsOpened() {
+		writer.Close()
+		return fmt.Errorf("failed to open %s for writing", name)
+	}
+
+	w.writer = writer
+	w.segment = Segment{
+		Camera: w.camera,
+		Kind:   w.kind,
+		Path:   name,
+		Start:  start,
+		End:    start,
+		Width:  width,
+		Height: height,
+	}
+
+	if w.indexOpen {
+		if err := Storage.Add(w.segment); err != nil {
+			writer.Close()
+			w.writer = nil
+			os.Remove(path)
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *segmentWriter) write(mat gocv.Mat, at time.Time) error {
+	if err := w.writer.Write(mat); err != nil {
+		return err
+	}
+	w.segment.Frames++
+	w.segment.End = at
+	return nil
+}
+
+// Closes the file and adds it to the index, a recording is only listed once
+// its file is complete unless it was indexed when opened. Returns false when
+// nothing was recorded.
+func (w *segmentWriter) close() (Segment, bool) {
+	if w.writer == nil {
+		return Segment{}, false
+	}
+
+	if err := w.writer.Close(); err != nil {
+		fmt.Printf("camera %s failed to close recording: %v\n", w.camera, err)
+	}
+	w.writer = nil
+
+	path, err := StoragePath(w.segment.Path)
+	if err != nil {
+		return Segment{}, false
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || w.segment.Frames == 0 {
+		os.Remove(path)
+		if w.indexOpen {
+			Storage.Delete(w.segment)
+		}
+		return Segment{}, false
+	}
+	w.segment.Size = info.Size()
+
+	if err := Storage.Add(w.segment); err != nil {
+		fmt.Println(err)
+		return Segment{}, false
+	}
+	return w.segment, true
+}
+
+// Completes the entries of indexed segments whose writer never closed, e.g.
+// after a crash, from their files. Entries without a file are removed.
+func recoverOpenSegments() {
+	segments, err := Storage.List("", time.Time{}, time.Time{})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	for _, seg := range segments {
+		if seg.Size > 0 {
+			continue
+		}
+
+		path, err := StoragePath(seg.Path)
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || info.Size() == 0 {
+			os.Remove(path)
+			if err := Storage.Delete(seg); err != nil {
+				fmt.Printf("failed to remove recording %s from the index: %v\n", seg.Path, err)
+			}
+			continue
+		}
+
+		seg.Size = info.Size()
+		seg.End = info.ModTime()
+		if err := Storage.Add(seg); err != nil {
+			fmt.Println(err)
+			continue
+		}
+		fmt.Printf("recovered unfinished recording %s\n", seg.Path)
+	}
+}
@@ -0,0 +1,156 @@
+// core/rtsp/rtsp.go
+package rtsp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"smuggr.xyz/gatecam/common/config"
+	"smuggr.xyz/gatecam/core/cameras"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/auth"
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+)
+
+const realm = "Gatecam"
+
+var Config *config.APIConfig
+var Server *gortsplib.Server
+var Streams = make(map[string]*Stream)
+
+type serverHandler struct {
+	nonce    string
+	mu       sync.Mutex
+	sessions map[*gortsplib.ServerSession]*Stream
+}
+
+// Cameras are published under their name and, like the external router,
+// require the camera name and its access key as credentials.
+func (h *serverHandler) authorize(req *base.Request, path string) (*Stream, *base.Response) {
+	cam, ok := cameras.Server.GetCamera(strings.TrimPrefix(path, "/"))
+	if !ok {
+		return nil, &base.Response{StatusCode: base.StatusNotFound}
+	}
+
+	stream, ok := Streams[cam.Name]
+	if !ok {
+		return nil, &base.Response{StatusCode: base.StatusNotFound}
+	}
+
+	if err := auth.Validate(req, cam.Name, cam.GetAccessKey(), nil, realm, h.nonce); err != nil {
+		return nil, &base.Response{
+			StatusCode: base.StatusUnauthorized,
+			Header: base.Header{
+				"WWW-Authenticate": auth.GenerateWWWAuthenticate(nil, realm, h.nonce),
+			},
+		}
+	}
+
+	return stream, &base.Response{StatusCode: base.StatusOK}
+}
+
+func (h *serverHandler) OnDescribe(ctx *gortsplib.ServerHandlerOnDescribeCtx) (*base.Response, *gortsplib.ServerStream, error) {
+	stream, res := h.authorize(ctx.Request, ctx.Path)
+	if stream == nil {
+		return res, nil, nil
+	}
+	return res, stream.stream, nil
+}
+
+func (h *serverHandler) OnSetup(ctx *gortsplib.ServerHandlerOnSetupCtx) (*base.Response, *gortsplib.ServerStream, error) {
+	stream, res := h.authorize(ctx.Request, ctx.Path)
+	if stream == nil {
+		return res, nil, nil
+	}
+
+	h.mu.Lock()
+	h.sessions[ctx.Session] = stream
+	h.mu.Unlock()
+
+	return res, stream.stream, nil
+}
+
+func (h *serverHandler) OnPlay(ctx *gortsplib.ServerHandlerOnPlayCtx) (*base.Response, error) {
+	h.mu.Lock()
+	stream, ok := h.sessions[ctx.Session]
+	h.mu.Unlock()
+
+	if !ok {
+		return &base.Response{StatusCode: base.StatusBadRequest}, nil
+	}
+
+	stream.addReader(ctx.Session)
+	return &base.Response{StatusCode: base.StatusOK}, nil
+}
+
+func (h *serverHandler) OnSessionClose(ctx *gortsplib.ServerHandlerOnSessionCloseCtx) {
+	h.mu.Lock()
+	stream, ok := h.sessions[ctx.Session]
+	delete(h.sessions, ctx.Session)
+	h.mu.Unlock()
+
+	if ok {
+		stream.removeReader(ctx.Session)
+	}
+}
+
+func Initialize() error {
+	Config = &config.Global.API
+	if Config.RTSPPort == 0 {
+		return nil
+	}
+
+	fmt.Println("initializing rtsp")
+
+	nonce, err := auth.GenerateNonce()
+	if err != nil {
+		return err
+	}
+
+	Server = &gortsplib.Server{
+		RTSPAddress: ":" + strconv.Itoa(int(Config.RTSPPort)),
+		Handler: &serverHandler{
+			nonce:    nonce,
+			sessions: make(map[*gortsplib.ServerSession]*Stream),
+		},
+	}
+	if Config.RTSPUDPPort != 0 {
+		Server.UDPRTPAddress = ":" + strconv.Itoa(int(Config.RTSPUDPPort))
+		Server.UDPRTCPAddress = ":" + strconv.Itoa(int(Config.RTSPUDPPort)+1)
+	}
+
+	if err := Server.Start(); err != nil {
+		Server = nil
+		return fmt.Errorf("failed to start RTSP server: %v", err)
+	}
+
+	for _, camConfig := range config.Global.Cameras {
+		if _, ok := camConfig.Modes[config.ModeJPEGStream]; !ok {
+			continue
+		}
+
+		cam, ok := cameras.Server.GetCamera(camConfig.Name)
+		if !ok {
+			continue
+		}
+
+		Streams[cam.Name] = NewStream(Server, cam)
+		fmt.Printf("RTSP stream of camera %s on port %d\n", cam.Name, Config.RTSPPort)
+	}
+
+	return nil
+}
+
+func Close() {
+	if Server == nil {
+		return
+	}
+
+	for _, stream := range Streams {
+		stream.Close()
+	}
+	Server.Close()
+}
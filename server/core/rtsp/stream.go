@@ -0,0 +1,151 @@
+// core/rtsp/stream.go
+package rtsp
+
+import (
+	"fmt"
+	"sync"
+
+	"smuggr.xyz/gatecam/common/config"
+	"smuggr.xyz/gatecam/core/cameras"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+)
+
+// Publishes the jpeg_stream output of a camera as RFC 2435 MJPEG. The
+// camera broadcaster is only subscribed to while somebody is playing.
+type Stream struct {
+	cam     *cameras.Camera
+	media   *description.Media
+	format  *format.MJPEG
+	stream  *gortsplib.ServerStream
+	mu      sync.Mutex
+	readers map[*gortsplib.ServerSession]struct{}
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func NewStream(server *gortsplib.Server, cam *cameras.Camera) *Stream {
+	forma := &format.MJPEG{}
+	media := &description.Media{
+		Type:    description.MediaTypeVideo,
+		Formats: []format.Format{forma},
+	}
+
+	return &Stream{
+		cam:     cam,
+		media:   media,
+		format:  forma,
+		stream:  gortsplib.NewServerStream(server, &description.Session{Medias: []*description.Media{media}}),
+		readers: make(map[*gortsplib.ServerSession]struct{}),
+	}
+}
+
+func (s *Stream) addReader(session *gortsplib.ServerSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.readers[session] = struct{}{}
+	if s.stop == nil {
+		s.stop = make(chan struct{})
+		s.wg.Add(1)
+		go s.run(s.stop)
+	}
+}
+
+func (s *Stream) removeReader(session *gortsplib.ServerSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.readers[session]; !ok {
+		return
+	}
+
+	delete(s.readers, session)
+	if len(s.readers) == 0 && s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+func (s *Stream) run(stop chan struct{}) {
+	defer s.wg.Done()
+
+	// A run ending on its own leaves its readers without packets, they are
+	// disconnected so their players reconnect and start a new run
+	defer func() {
+		s.mu.Lock()
+		if s.stop != stop {
+			s.mu.Unlock()
+			return
+		}
+		s.stop = nil
+		readers := s.readers
+		s.readers = make(map[*gortsplib.ServerSession]struct{})
+		s.mu.Unlock()
+
+		for session := range readers {
+			session.Close()
+		}
+	}()
+
+	sub, err := s.cam.Subscribe(config.ModeJPEGStream)
+	if err != nil {
+		fmt.Printf("RTSP stream of %s failed: %v\n", s.cam.Name, err)
+		return
+	}
+	defer sub.Close()
+
+	encoder, err := s.format.CreateEncoder()
+	if err != nil {
+		fmt.Printf("RTSP stream of %s failed: %v\n", s.cam.Name, err)
+		return
+	}
+
+	var start *cameras.EncodedFrame
+	var failing bool
+	for {
+		frame, ok := sub.Next(stop)
+		if !ok {
+			return
+		}
+		if start == nil {
+			start = frame
+		}
+
+		packets, err := encoder.Encode(frame.Data)
+		if err != nil {
+			fmt.Printf("RTSP stream of %s dropped frame %d: %v\n", s.cam.Name, frame.Seq, err)
+			continue
+		}
+
+		// A failed write only affects this frame, it is logged once until
+		// writes succeed again
+		timestamp := uint32(frame.Timestamp.Sub(start.Timestamp).Seconds() * float64(s.format.ClockRate()))
+		for _, packet := range packets {
+			packet.Timestamp = timestamp
+			if err = s.stream.WritePacketRTPWithNTP(s.media, packet, frame.Timestamp); err != nil {
+				break
+			}
+		}
+
+		if err != nil && !failing {
+			fmt.Printf("RTSP stream of %s failed to write frame %d: %v\n", s.cam.Name, frame.Seq, err)
+		}
+		failing = err != nil
+	}
+}
+
+func (s *Stream) Close() {
+	s.mu.Lock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+	s.readers = make(map[*gortsplib.ServerSession]struct{})
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	s.stream.Close()
+}
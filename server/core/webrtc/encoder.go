@@ -0,0 +1,205 @@
+// core/webrtc/encoder.go
+package webrtc
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"smuggr.xyz/gatecam/common/config"
+	"smuggr.xyz/gatecam/core/cameras"
+
+	"github.com/pion/webrtc/v4/pkg/media"
+	"github.com/pion/webrtc/v4/pkg/media/ivfreader"
+	"gocv.io/x/gocv"
+)
+
+const (
+	defaultBitrate    = 1000
+	defaultFrameRate  = 15
+	defaultFFmpegPath = "ffmpeg"
+	staleFrameAge     = 2 * time.Second
+)
+
+// Produces encoded VP8 samples until stop is closed. Tests can swap the
+// camera encoder for one writing prepared samples.
+type Encoder interface {
+	Run(stop <-chan struct{}, write func(media.Sample) error) error
+}
+
+// Feeds rendered jpeg_stream frames of a camera as raw BGR into ffmpeg and
+// reads VP8 back from its IVF output.
+type cameraEncoder struct {
+	cam        *cameras.Camera
+	ffmpegPath string
+	bitrate    int
+	frameRate  int
+}
+
+func newCameraEncoder(cam *cameras.Camera, camConfig config.CameraConfig, ffmpegPath string) *cameraEncoder {
+	encoder := &cameraEncoder{
+		cam:        cam,
+		ffmpegPath: ffmpegPath,
+		bitrate:    camConfig.WebRTC.Bitrate,
+		frameRate:  camConfig.WebRTC.FrameRate,
+	}
+
+	if encoder.ffmpegPath == "" {
+		encoder.ffmpegPath = defaultFFmpegPath
+	}
+	if encoder.bitrate <= 0 {
+		encoder.bitrate = defaultBitrate
+	}
+	if encoder.frameRate <= 0 {
+		encoder.frameRate = camConfig.FrameRate
+	}
+	if encoder.frameRate <= 0 {
+		encoder.frameRate = defaultFrameRate
+	}
+
+	return encoder
+}
+
+// Waits for the first fresh frame, its size is kept for the whole run.
+func (e *cameraEncoder) firstFrame(stop <-chan struct{}, ticker *time.Ticker) (gocv.Mat, bool) {
+	for {
+		select {
+		case <-stop:
+			return gocv.Mat{}, false
+		case <-ticker.C:
+		}
+
+		frame := e.cam.LatestFrame()
+		if frame == nil {
+			continue
+		}
+		if time.Since(frame.Timestamp) > staleFrameAge {
+			frame.Release()
+			continue
+		}
+
+		mat := e.cam.Render(frame, config.ModeJPEGStream)
+		frame.Release()
+		return mat, true
+	}
+}
+
+func (e *cameraEncoder) Run(stop <-chan struct{}, write func(media.Sample) error) error {
+	ticker := time.NewTicker(time.Second / time.Duration(e.frameRate))
+	defer ticker.Stop()
+
+	mat, ok := e.firstFrame(stop, ticker)
+	if !ok {
+		return nil
+	}
+	defer mat.Close()
+	size := image.Pt(mat.Cols(), mat.Rows())
+
+	cmd := exec.Command(e.ffmpegPath,
+		"-hide_banner", "-loglevel", "error",
+		"-f", "rawvideo", "-pix_fmt", "bgr24",
+		"-s", fmt.Sprintf("%dx%d", size.X, size.Y),
+		"-r", strconv.Itoa(e.frameRate),
+		"-i", "pipe:0",
+		"-c:v", "libvpx", "-deadline", "realtime", "-cpu-used", "8",
+		"-b:v", fmt.Sprintf("%dk", e.bitrate),
+		"-g", strconv.Itoa(e.frameRate*2), // New viewers wait at most two seconds for a keyframe
+		"-auto-alt-ref", "0",
+		"-f", "ivf", "pipe:1",
+	)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %v", err)
+	}
+
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- e.readSamples(stdout, write)
+	}()
+
+	// A write to a stalled ffmpeg only returns once the process is gone
+	exited := make(chan struct{})
+	go func() {
+		select {
+		case <-stop:
+			cmd.Process.Kill()
+		case <-exited:
+		}
+	}()
+
+	// Wait closes stdout, so it only runs after the reader is done with it
+	readDone := false
+	defer func() {
+		stdin.Close()
+		cmd.Process.Kill()
+		if !readDone {
+			<-readErr
+		}
+		close(exited)
+		cmd.Wait()
+	}()
+
+	for {
+		if mat.Cols() != size.X || mat.Rows() != size.Y {
+			gocv.Resize(mat, &mat, size, 0, 0, gocv.InterpolationLinear)
+		}
+		if _, err := stdin.Write(mat.ToBytes()); err != nil {
+			select {
+			case <-stop:
+				return nil
+			default:
+			}
+			return fmt.Errorf("failed to feed ffmpeg: %v", err)
+		}
+
+		select {
+		case <-stop:
+			return nil
+		case err := <-readErr:
+			readDone = true
+			return err
+		case <-ticker.C:
+		}
+
+		// A stalled source repeats its last frame to keep the timing
+		if frame := e.cam.LatestFrame(); frame != nil {
+			mat.Close()
+			mat = e.cam.Render(frame, config.ModeJPEGStream)
+			frame.Release()
+		}
+	}
+}
+
+func (e *cameraEncoder) readSamples(stdout io.Reader, write func(media.Sample) error) error {
+	reader, _, err := ivfreader.NewWith(stdout)
+	if err != nil {
+		return fmt.Errorf("failed to read ffmpeg output: %v", err)
+	}
+
+	duration := time.Second / time.Duration(e.frameRate)
+	for {
+		payload, _, err := reader.ParseNextFrame()
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("ffmpeg exited")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read ffmpeg output: %v", err)
+		}
+
+		if err := write(media.Sample{Data: payload, Duration: duration}); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,205 @@
+// core/webrtc/stream.go
+package webrtc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	pion "github.com/pion/webrtc/v4"
+)
+
+const (
+	gatheringTimeout = 5 * time.Second
+	restartDelay     = 2 * time.Second
+)
+
+type Session struct {
+	ID     string
+	stream *Stream
+	pc     *pion.PeerConnection
+}
+
+func (sess *Session) Close() {
+	sess.stream.removeSession(sess.ID)
+}
+
+// One encoder and one track per camera, shared by every peer. The encoder
+// only runs while at least one session exists.
+type Stream struct {
+	Name     string
+	api      *pion.API
+	config   pion.Configuration
+	encoder  Encoder
+	track    *pion.TrackLocalStaticSample
+	mu       sync.Mutex
+	sessions map[string]*Session
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+func NewStream(name string, api *pion.API, pcConfig pion.Configuration, encoder Encoder) (*Stream, error) {
+	track, err := pion.NewTrackLocalStaticSample(pion.RTPCodecCapability{MimeType: pion.MimeTypeVP8}, "video", "gatecam-"+name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create track: %v", err)
+	}
+
+	return &Stream{
+		Name:     name,
+		api:      api,
+		config:   pcConfig,
+		encoder:  encoder,
+		track:    track,
+		sessions: make(map[string]*Session),
+	}, nil
+}
+
+func newSessionID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// Answers a WHEP offer. ICE candidates are gathered before answering since
+// WHEP clients do not trickle towards us.
+func (s *Stream) Answer(offer string) (*Session, string, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return nil, "", err
+	}
+
+	pc, err := s.api.NewPeerConnection(s.config)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create peer connection: %v", err)
+	}
+
+	sender, err := pc.AddTransceiverFromTrack(s.track, pion.RTPTransceiverInit{Direction: pion.RTPTransceiverDirectionSendonly})
+	if err != nil {
+		pc.Close()
+		return nil, "", fmt.Errorf("failed to add track: %v", err)
+	}
+
+	// RTCP has to be read for the interceptors to work
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			if _, _, err := sender.Sender().Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	sess := &Session{ID: id, stream: s, pc: pc}
+	pc.OnConnectionStateChange(func(state pion.PeerConnectionState) {
+		switch state {
+		case pion.PeerConnectionStateFailed, pion.PeerConnectionStateClosed:
+			s.removeSession(id)
+		}
+	})
+
+	if err := pc.SetRemoteDescription(pion.SessionDescription{Type: pion.SDPTypeOffer, SDP: offer}); err != nil {
+		pc.Close()
+		return nil, "", fmt.Errorf("invalid offer: %v", err)
+	}
+
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		pc.Close()
+		return nil, "", fmt.Errorf("failed to create answer: %v", err)
+	}
+
+	gathered := pion.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(answer); err != nil {
+		pc.Close()
+		return nil, "", fmt.Errorf("failed to set local description: %v", err)
+	}
+
+	select {
+	case <-gathered:
+	case <-time.After(gatheringTimeout):
+	}
+
+	s.addSession(sess)
+	return sess, pc.LocalDescription().SDP, nil
+}
+
+func (s *Stream) Session(id string) (*Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[id]
+	return sess, ok
+}
+
+func (s *Stream) Sessions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.sessions)
+}
+
+func (s *Stream) addSession(sess *Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[sess.ID] = sess
+	if s.stop == nil {
+		s.stop = make(chan struct{})
+		s.wg.Add(1)
+		go s.run(s.stop)
+	}
+}
+
+func (s *Stream) removeSession(id string) {
+	s.mu.Lock()
+	sess, ok := s.sessions[id]
+	delete(s.sessions, id)
+	if len(s.sessions) == 0 && s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+	s.mu.Unlock()
+
+	if ok {
+		sess.pc.Close()
+	}
+}
+
+// A failing encoder is restarted for as long as anybody is watching.
+func (s *Stream) run(stop chan struct{}) {
+	defer s.wg.Done()
+
+	for {
+		err := s.encoder.Run(stop, s.track.WriteSample)
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		fmt.Printf("WebRTC encoder of %s stopped: %v\n", s.Name, err)
+		select {
+		case <-stop:
+			return
+		case <-time.After(restartDelay):
+		}
+	}
+}
+
+func (s *Stream) Close() {
+	s.mu.Lock()
+	ids := make([]string, 0, len(s.sessions))
+	for id := range s.sessions {
+		ids = append(ids, id)
+	}
+	s.mu.Unlock()
+
+	for _, id := range ids {
+		s.removeSession(id)
+	}
+	s.wg.Wait()
+}
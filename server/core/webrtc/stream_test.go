@@ -0,0 +1,160 @@
+// core/webrtc/stream_test.go
+package webrtc
+
+import (
+	"testing"
+	"time"
+
+	pion "github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+// A VP8 keyframe header followed by padding, enough for the packetizer.
+var testSample = []byte{0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a, 0x40, 0x01, 0xf0, 0x00, 0x00, 0x00}
+
+type fakeEncoder struct {
+	started chan struct{}
+	stopped chan struct{}
+}
+
+func newFakeEncoder() *fakeEncoder {
+	return &fakeEncoder{
+		started: make(chan struct{}, 8),
+		stopped: make(chan struct{}, 8),
+	}
+}
+
+func (e *fakeEncoder) Run(stop <-chan struct{}, write func(media.Sample) error) error {
+	e.started <- struct{}{}
+	defer func() { e.stopped <- struct{}{} }()
+
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			if err := write(media.Sample{Data: testSample, Duration: 20 * time.Millisecond}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func waitFor(t *testing.T, ch <-chan struct{}, what string) {
+	t.Helper()
+
+	select {
+	case <-ch:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+}
+
+// Connects a receive-only peer in the same process, as a WHEP client would.
+func connectPeer(t *testing.T, stream *Stream) (*pion.PeerConnection, *Session, <-chan struct{}) {
+	t.Helper()
+
+	peer, err := pion.NewPeerConnection(pion.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := peer.AddTransceiverFromKind(pion.RTPCodecTypeVideo, pion.RTPTransceiverInit{Direction: pion.RTPTransceiverDirectionRecvonly}); err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan struct{}, 1)
+	peer.OnTrack(func(track *pion.TrackRemote, _ *pion.RTPReceiver) {
+		for {
+			if _, _, err := track.ReadRTP(); err != nil {
+				return
+			}
+			select {
+			case received <- struct{}{}:
+			default:
+			}
+		}
+	})
+
+	offer, err := peer.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gathered := pion.GatheringCompletePromise(peer)
+	if err := peer.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	<-gathered
+
+	sess, answer, err := stream.Answer(peer.LocalDescription().SDP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := peer.SetRemoteDescription(pion.SessionDescription{Type: pion.SDPTypeAnswer, SDP: answer}); err != nil {
+		t.Fatal(err)
+	}
+
+	return peer, sess, received
+}
+
+func TestStreamLoopback(t *testing.T) {
+	encoder := newFakeEncoder()
+	stream, err := NewStream("test", pion.NewAPI(), pion.Configuration{}, encoder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	first, firstSess, firstReceived := connectPeer(t, stream)
+	defer first.Close()
+	second, secondSess, secondReceived := connectPeer(t, stream)
+	defer second.Close()
+
+	waitFor(t, encoder.started, "encoder start")
+	waitFor(t, firstReceived, "RTP on the first peer")
+	waitFor(t, secondReceived, "RTP on the second peer")
+
+	if n := stream.Sessions(); n != 2 {
+		t.Fatalf("expected 2 sessions, got %d", n)
+	}
+
+	// Both peers share one encoder, it keeps running for the remaining one
+	firstSess.Close()
+	select {
+	case <-encoder.stopped:
+		t.Fatal("encoder stopped while a session was left")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Closing through the session lookup, like the DELETE handler does
+	sess, ok := stream.Session(secondSess.ID)
+	if !ok {
+		t.Fatal("session not found")
+	}
+	sess.Close()
+
+	waitFor(t, encoder.stopped, "encoder stop")
+	if n := stream.Sessions(); n != 0 {
+		t.Fatalf("expected 0 sessions, got %d", n)
+	}
+	if _, ok := stream.Session(secondSess.ID); ok {
+		t.Fatal("closed session is still listed")
+	}
+}
+
+func TestStreamRejectsInvalidOffer(t *testing.T) {
+	stream, err := NewStream("test", pion.NewAPI(), pion.Configuration{}, newFakeEncoder())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	if _, _, err := stream.Answer("not sdp"); err == nil {
+		t.Fatal("expected an error for an invalid offer")
+	}
+	if n := stream.Sessions(); n != 0 {
+		t.Fatalf("expected 0 sessions, got %d", n)
+	}
+}
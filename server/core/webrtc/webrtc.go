@@ -0,0 +1,77 @@
+// core/webrtc/webrtc.go
+package webrtc
+
+import (
+	"fmt"
+
+	"smuggr.xyz/gatecam/common/config"
+	"smuggr.xyz/gatecam/core/cameras"
+
+	pion "github.com/pion/webrtc/v4"
+)
+
+var Config *config.StreamingConfig
+var Streams = make(map[string]*Stream)
+
+func newAPI() (*pion.API, error) {
+	settings := pion.SettingEngine{}
+
+	if Config.UDPPortMin > 0 || Config.UDPPortMax > 0 {
+		if err := settings.SetEphemeralUDPPortRange(Config.UDPPortMin, Config.UDPPortMax); err != nil {
+			return nil, fmt.Errorf("invalid WebRTC port range: %v", err)
+		}
+	}
+	if len(Config.PublicIPs) > 0 {
+		settings.SetNAT1To1IPs(Config.PublicIPs, pion.ICECandidateTypeHost)
+	}
+
+	return pion.NewAPI(pion.WithSettingEngine(settings)), nil
+}
+
+func GetStream(cam *cameras.Camera) (*Stream, bool) {
+	stream, ok := Streams[cam.Name]
+	return stream, ok
+}
+
+func Initialize() error {
+	fmt.Println("initializing webrtc")
+	Config = &config.Global.Streaming
+
+	api, err := newAPI()
+	if err != nil {
+		return err
+	}
+
+	pcConfig := pion.Configuration{}
+	if len(Config.ICEServers) > 0 {
+		pcConfig.ICEServers = []pion.ICEServer{{URLs: Config.ICEServers}}
+	}
+
+	for _, camConfig := range config.Global.Cameras {
+		if !camConfig.WebRTC.Enabled {
+			continue
+		}
+
+		cam, ok := cameras.Server.GetCamera(camConfig.Name)
+		if !ok {
+			continue
+		}
+
+		stream, err := NewStream(cam.Name, api, pcConfig, newCameraEncoder(cam, camConfig, Config.FFmpegPath))
+		if err != nil {
+			fmt.Printf("camera %s runs without WebRTC: %v\n", cam.Name, err)
+			continue
+		}
+
+		Streams[cam.Name] = stream
+		fmt.Printf("WebRTC enabled for camera %s\n", cam.Name)
+	}
+
+	return nil
+}
+
+func Close() {
+	for _, stream := range Streams {
+		stream.Close()
+	}
+}